@@ -1,11 +1,439 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/immanuel-254/bradley/internal/lib"
 )
 
+const usage = `usage:
+  bradley [flags] <file.go|dir>...
+  bradley -config file -profile name,... [flags] [file.go|dir]
+  bradley update [flags] <file.go|dir>
+  bradley plan [flags] <file.go|dir>
+  bradley clean <output dir>
+  bradley config validate [-config file]
+  bradley doctor [-config file] [dir]
+  bradley publish [-config file] -version v (-remote r | -proxy url) <dir>
+  bradley version
+  bradley self-update [-check]
+  go tool bradley (no arguments, in a module with a bradley tool directive)`
+
 func main() {
-	//lib.GenerateFiles()
+	if len(os.Args) < 2 {
+		// `go tool bradley` in a module declaring it runs with its defaults
+		args, err := lib.GoToolArgs(".")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bradley:", err)
+		}
+		if args == nil {
+			fmt.Fprintln(os.Stderr, usage)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "bradley: running as go tool: bradley %s\n", strings.Join(args, " "))
+		os.Args = append(os.Args, args...)
+	}
+	stopOnSignal()
+
+	switch os.Args[1] {
+	case "version":
+		printVersion()
+	case "self-update":
+		if err := selfUpdate(os.Args[2:]); err != nil {
+			fail("self-update", err)
+		}
+	case "config":
+		configCommand(os.Args[2:])
+	case "doctor":
+		doctorCommand(os.Args[2:])
+	case "clean":
+		if len(os.Args) != 3 {
+			fmt.Fprintln(os.Stderr, "usage: bradley clean <output dir>")
+			os.Exit(2)
+		}
+		if err := lib.Clean(os.Args[2]); err != nil {
+			fail("clean", err)
+		}
+	case "publish":
+		dir, opts, run := publishFlags(os.Args[2:])
+		if err := lib.Publish(dir, opts, run); err != nil {
+			fail("publish", err)
+		}
+	case "update":
+		opts, inputs, _ := parseFlags("update", os.Args[2:])
+		if err := lib.UpdateFiles(oneInput("update", inputs), opts); err != nil {
+			fail("update", err)
+		}
+	case "plan":
+		opts, inputs, _ := parseFlags("plan", os.Args[2:])
+		plan, err := lib.PlanSubpackages(oneInput("plan", inputs), opts)
+		if err != nil {
+			fail("plan", err)
+		}
+		fmt.Fprint(progress, plan)
+		if !plan.OK() {
+			os.Exit(1)
+		}
+	default:
+		opts, inputs, profiles := parseFlags("bradley", os.Args[1:])
+		var err error
+		if profiles != nil {
+			err = lib.GenerateProfiles(oneInput("bradley -profile", inputs), profiles)
+		} else {
+			_, _, err = lib.Generate(inputs, opts)
+		}
+		if err != nil {
+			fail("bradley", err)
+		}
+		fmt.Fprintln(progress, "Successfully split files!")
+	}
+}
+
+// progress is where the human-readable output of a run goes: stdout,
+// unless -events streams there.
+var progress io.Writer = os.Stdout
+
+// caught is the signal that interrupted the run, see signalStatus.
+var caught atomic.Value
+
+// stopOnSignal interrupts the run on the first SIGINT or SIGTERM, letting
+// it kill its go processes and clean up, and exits at once on a second.
+func stopOnSignal() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		caught.Store(<-signals)
+		fmt.Fprintln(os.Stderr, "bradley: stopping, interrupt again to exit now")
+		lib.Interrupt()
+		<-signals
+		os.Exit(signalStatus())
+	}()
+}
+
+// signalStatus is the exit status the shell reports for a process the
+// caught signal killed: 128 plus its number, so 130 for SIGINT and 143
+// for SIGTERM.
+func signalStatus() int {
+	if sig, ok := caught.Load().(syscall.Signal); ok {
+		return 128 + int(sig)
+	}
+	return 130
+}
+
+// fail reports err, as an error event too, and exits with signalStatus
+// when the run was interrupted, 1 otherwise.
+func fail(name string, err error) {
+	if lib.Interrupted() {
+		err = lib.ErrInterrupted
+	}
+	lib.SendEvent(lib.Event{Type: "error", Message: err.Error()})
+	fmt.Fprintln(os.Stderr, name+":", err)
+	if lib.Interrupted() {
+		os.Exit(signalStatus())
+	}
+	os.Exit(1)
+}
+
+// parseFlags reads the generation options and inputs shared by every
+// command that takes one, exiting on misuse. With -config the file
+// supplies the input and defaults, which flags then override. With -profile it also
+// returns the options of each named profile, flags applied over them
+// the same way.
+func parseFlags(name string, args []string) (lib.Options, []string, map[string]lib.Options) {
+	var cfg lib.Config
+	if file := configArg(args); file != "" {
+		loaded, err := lib.LoadConfig(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, name+":", err)
+			os.Exit(2)
+		}
+		cfg = *loaded
+	}
+	opts, fs := parseOptions(name, args, cfg.Options)
+	inputs := fs.Args()
+	if len(inputs) == 0 && cfg.Input != "" {
+		inputs = []string{cfg.Input}
+	}
+	if len(inputs) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	switch events := fs.Lookup("events").Value.String(); events {
+	case "":
+	case "ndjson":
+		lib.StreamEvents(os.Stdout)
+		lib.SetProgress(os.Stderr)
+		progress = os.Stderr
+	default:
+		fmt.Fprintf(os.Stderr, "%s: unknown -events format %q (want ndjson)\n", name, events)
+		os.Exit(2)
+	}
+
+	var profiles map[string]lib.Options
+	if names := fs.Lookup("profile").Value.String(); names != "" {
+		profiles = map[string]lib.Options{}
+		for _, profile := range strings.Split(names, ",") {
+			base, err := cfg.Profile(profile)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, name+":", err)
+				os.Exit(2)
+			}
+			profiles[profile], _ = parseOptions(name, args, base)
+		}
+	}
+	return opts, inputs, profiles
+}
+
+// oneInput returns the only input of a command that cannot batch,
+// exiting when there are more.
+func oneInput(name string, inputs []string) string {
+	if len(inputs) > 1 {
+		fmt.Fprintln(os.Stderr, name+": takes a single input")
+		os.Exit(2)
+	}
+	return inputs[0]
+}
+
+// parseOptions parses the flags in args over base, which gives each flag
+// its default.
+func parseOptions(name string, args []string, opts lib.Options) (lib.Options, *flag.FlagSet) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+		fs.PrintDefaults()
+	}
+	fs.String("config", "", "read the input and default options from this JSON `file`")
+	fs.String("profile", "", "generate one output per config profile in this comma-separated `list`")
+	fs.String("events", "", `"ndjson" streams one JSON event per line (phases, files written, warnings, errors) to stdout, moving progress to stderr`)
+	fs.BoolVar(&opts.MethodsByReceiver, "by-receiver", opts.MethodsByReceiver, "write one methods file per receiver type")
+	fs.BoolVar(&opts.InterfaceFiles, "interface-files", opts.InterfaceFiles, "write each interface declaration to its own file")
+	fs.BoolVar(&opts.WithImpls, "with-impls", opts.WithImpls, "with -interface-files, move documented implementations next to their interface")
+	fs.IntVar(&opts.Files, "files", opts.Files, "spread the declarations over `n` files of about equal length instead of kind buckets")
+	fs.BoolVar(&opts.Index, "index", opts.Index, "write INDEX.md listing every exported symbol with the file declaring it")
+	fs.BoolVar(&opts.Overlay, "overlay", opts.Overlay, "write overlay.json to try the split in place with go build -overlay instead of as a new module")
+	fs.BoolVar(&opts.InternalHelpers, "internal-helpers", opts.InternalHelpers, "move self-contained unexported functions into internal/helpers behind forwarders")
+	fs.BoolVar(&opts.Link, "link", opts.Link, "symlink third_party modules from the module cache instead of copying (local development only)")
+	fs.StringVar(&opts.SharedThirdParty, "shared-third-party", opts.SharedThirdParty, "shade into this `dir`, a module shared by several outputs, instead of each output's third_party")
+	fs.BoolVar(&opts.FlatThirdParty, "flat", opts.FlatThirdParty, "drop the host from third_party paths (third_party/pkg/errors), keeping it only on collisions")
+	fs.BoolVar(&opts.Nested, "nested", opts.Nested, "write the output as a nested module at the root of the input's module")
+	fs.StringVar(&opts.Zip, "zip", opts.Zip, "also package the output as a module proxy zip for this `version`")
+	fs.StringVar(&opts.Namespace, "namespace", opts.Namespace, "rewrite shaded imports under this import `path` instead of <output>/third_party")
+	fs.BoolVar(&opts.Tools, "tools", opts.Tools, "carry the input's tool dependencies over to the output, pointed at their shaded copies")
+	fs.BoolVar(&opts.CheckUpstream, "check-upstream", opts.CheckUpstream, "warn about shaded modules deprecated upstream or at retracted versions (needs the module proxy)")
+	fs.BoolVar(&opts.DepsDev, "deps-dev", opts.DepsDev, "add latest versions, stars and OpenSSF scorecards from deps.dev to the dependency summary")
+	fs.IntVar(&opts.Concurrency, "concurrency", opts.Concurrency, "at most this many HTTP requests at once (default 4)")
+	fs.Float64Var(&opts.RateLimit, "rate-limit", opts.RateLimit, "at most this many HTTP requests per second (0 for no limit)")
+	fs.IntVar(&opts.Retries, "retries", opts.Retries, "retry failed HTTP requests this many times with backoff (default 3, negative for none)")
+	fs.BoolVar(&opts.NoCache, "no-cache", opts.NoCache, "do not reuse goimports results cached by earlier runs")
+	fs.BoolVar(&opts.Mangle, "mangle", opts.Mangle, "rename unexported identifiers and strip comments and layout in shaded packages")
+	fs.BoolVar(&opts.RewriteStrings, "rewrite-strings", opts.RewriteStrings, "rewrite string literals naming a shaded module to its shaded path (reported)")
+	fs.Func("strip-comments", `drop comments from "third_party" sources, keeping license headers and directives`, func(v string) error {
+		if v != "third_party" {
+			return fmt.Errorf(`only "third_party" is supported`)
+		}
+		opts.StripComments = v
+		return nil
+	})
+	fs.Func("max-third-party-size", "fail when third_party exceeds this `size` (e.g. 200MB)", func(v string) error {
+		n, err := lib.ParseSize(v)
+		opts.MaxThirdPartySize = n
+		return err
+	})
+	fs.Func("allow-licenses", "comma-separated SPDX `ids` shaded modules may carry (prefixes such as BSD allowed)", func(v string) error {
+		opts.AllowLicenses = append(opts.AllowLicenses, strings.Split(v, ",")...)
+		return nil
+	})
+	fs.Func("deny-licenses", "comma-separated SPDX `ids` shaded modules must not carry (e.g. AGPL,GPL)", func(v string) error {
+		opts.DenyLicenses = append(opts.DenyLicenses, strings.Split(v, ",")...)
+		return nil
+	})
+	fs.StringVar(&opts.LicensePolicy, "license-policy", opts.LicensePolicy, `"warn" reports license policy violations instead of failing`)
+	fs.Func("verify-platforms", "comma-separated `GOOS/GOARCH` pairs (or tinygo/target) the output must build for, \"default\" or \"wasm\"", func(v string) error {
+		for _, platform := range strings.Split(v, ",") {
+			switch platform {
+			case "default":
+				opts.VerifyPlatforms = append(opts.VerifyPlatforms, lib.DefaultVerifyPlatforms...)
+			case "wasm":
+				opts.VerifyPlatforms = append(opts.VerifyPlatforms, lib.WasmVerifyPlatforms...)
+			default:
+				opts.VerifyPlatforms = append(opts.VerifyPlatforms, platform)
+			}
+		}
+		return nil
+	})
+	pruneDirs := lib.DefaultPruneDirs
+	if opts.PruneDirs != nil {
+		pruneDirs = opts.PruneDirs
+	}
+	prune := fs.String("prune", strings.Join(pruneDirs, ","), "comma-separated directory names dropped from shaded modules (empty for none)")
+	fs.StringVar(&opts.HeaderFiles, "header-files", opts.HeaderFiles, `glob of generated files that keep the input's license header ("-" for none)`)
+	fs.Func("extract-interfaces", "comma-separated concrete types to generate interfaces for in interfaces.go", func(v string) error {
+		opts.ExtractInterfaces = append(opts.ExtractInterfaces, strings.Split(v, ",")...)
+		return nil
+	})
+	fs.Func("subpackage", "`name=pattern,...` moves matching declarations into subpackage name (repeatable)", func(v string) error {
+		name, patterns, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("want name=pattern,...")
+		}
+		if opts.Subpackages == nil {
+			opts.Subpackages = map[string][]string{}
+		}
+		opts.Subpackages[name] = append(opts.Subpackages[name], strings.Split(patterns, ",")...)
+		return nil
+	})
+	if opts.CycleStrategy == "" {
+		opts.CycleStrategy = "report"
+	}
+	fs.StringVar(&opts.CycleStrategy, "cycles", opts.CycleStrategy, `how to resolve import cycles between subpackages: "report" or "merge"`)
+	fs.Parse(args)
+	opts.PruneDirs = []string{}
+	if *prune != "" {
+		opts.PruneDirs = strings.Split(*prune, ",")
+	}
+	return opts, fs
+}
+
+// configArg finds the -config flag ahead of parsing, since the file it
+// names provides the other flags' defaults.
+func configArg(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// publishFlags reads the arguments of "bradley publish", taking defaults
+// from the config's publish section.
+func publishFlags(args []string) (string, lib.PublishOptions, lib.Options) {
+	var opts lib.PublishOptions
+	var run lib.Options // Only the network's settings apply
+	if file := configArg(args); file != "" {
+		cfg, err := lib.LoadConfig(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "publish:", err)
+			os.Exit(2)
+		}
+		opts, run = cfg.Publish, cfg.Options
+	}
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bradley publish [-config file] -version v (-remote r | -proxy url) <dir>")
+		fs.PrintDefaults()
+	}
+	fs.String("config", "", "read publish defaults from this JSON `file`")
+	fs.StringVar(&opts.Version, "version", opts.Version, "semantic `version` to publish")
+	fs.StringVar(&opts.Remote, "remote", opts.Remote, "git `remote` to push the version tag to")
+	fs.StringVar(&opts.Proxy, "proxy", opts.Proxy, "module proxy `url` to upload the module zip to")
+	fs.IntVar(&run.Concurrency, "concurrency", run.Concurrency, "at most this many HTTP requests at once (default 4)")
+	fs.Float64Var(&run.RateLimit, "rate-limit", run.RateLimit, "at most this many HTTP requests per second (0 for no limit)")
+	fs.IntVar(&run.Retries, "retries", run.Retries, "retry failed HTTP requests this many times with backoff (default 3, negative for none)")
+	fs.Parse(args)
+	if fs.NArg() != 1 || opts.Version == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return fs.Arg(0), opts, run
+}
+
+// configCommand implements "bradley config validate": it checks a config
+// file and prints the effective configuration it resolves to.
+func configCommand(args []string) {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	file := fs.String("config", lib.ConfigFile, "config `file` to check")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bradley config validate [-config file]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "validate" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fs.Parse(args[1:])
+
+	cfg, err := lib.LoadConfig(*file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config:", err)
+		os.Exit(1)
+	}
+	errs := cfg.Validate()
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *file, err)
+	}
+	data, err := json.MarshalIndent(cfg.Resolved(), "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config:", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+}
+
+// doctorCommand implements "bradley doctor": it checks the environment a
+// run needs and says how to fix what is missing.
+func doctorCommand(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	file := fs.String("config", "", "config `file` to check (default bradley.json in dir, if any)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: bradley doctor [-config file] [dir]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	dir := "."
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		dir = fs.Arg(0)
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, c := range lib.Doctor(dir, *file) {
+		mark := "✅"
+		if !c.OK {
+			mark, failed = "❌", true
+		}
+		fmt.Printf("%s %s: %s\n", mark, c.Name, strings.ReplaceAll(c.Detail, "\n", "\n     "))
+		if c.Fix != "" {
+			fmt.Printf("   fix: %s\n", c.Fix)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
 
-	fmt.Println("Successfully split files!")
+func printVersion() {
+	info := lib.ReadBuildInfo()
+	fmt.Printf("bradley %s\n", info.Version)
+	if info.Commit != "" {
+		fmt.Printf("  commit:      %s\n", info.Commit)
+	}
+	fmt.Printf("  go:          %s\n", info.GoVersion)
+	fmt.Printf("  lock schema: %d\n", info.LockSchema)
 }
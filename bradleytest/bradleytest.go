@@ -0,0 +1,284 @@
+// Package bradleytest runs bradley from tests and compares its output
+// with golden trees.
+//
+// A typical regression test:
+//
+//	func TestSplit(t *testing.T) {
+//		out := bradleytest.Generate(t, "testdata/mylib", generate.Options{})
+//		bradleytest.CompareTree(t, out, "testdata/mylib.golden")
+//	}
+//
+// Run the tests with -bradley.update to rewrite the golden trees from
+// the current output.
+package bradleytest
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/immanuel-254/bradley/generate"
+)
+
+var update = flag.Bool("bradley.update", false, "rewrite bradleytest golden trees from the generated output")
+
+// DefaultIgnore lists output files that vary from run to run and are
+// left out of comparisons unless CompareTree is given its own list.
+var DefaultIgnore = []string{generate.LockFile, "go.sum"}
+
+// Generate copies the module holding input into a temporary directory,
+// runs the generator there and returns the directory of the generated
+// module. The caller's tree is never written to.
+func Generate(t testing.TB, input string, opts generate.Options) string {
+	t.Helper()
+	abs, err := filepath.Abs(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := moduleRoot(abs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keep the root's name: a directory input names the buckets
+	work := filepath.Join(t.TempDir(), filepath.Base(root))
+	if err := copyTree(root, work); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(work)
+	g := &generate.Generator{Options: opts}
+	res, err := g.Generate(t.Context(), rel)
+	if err != nil {
+		t.Fatalf("generating %s: %v", input, err)
+	}
+	// Back, so the golden paths the test goes on with resolve as written
+	t.Chdir(wd)
+	return filepath.Join(work, res.Dir)
+}
+
+// CompareTree fails t for every file that differs between the generated
+// tree got and the golden tree, with a line diff for changed files.
+// Files matching an ignore pattern (filepath.Match against the base name
+// or the slash-separated relative path) are skipped; without patterns,
+// DefaultIgnore applies. With -bradley.update the golden tree is
+// replaced by got instead.
+func CompareTree(t testing.TB, got, golden string, ignore ...string) {
+	t.Helper()
+	if len(ignore) == 0 {
+		ignore = DefaultIgnore
+	}
+	gotFiles, err := readTree(got, ignore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := os.RemoveAll(golden); err != nil {
+			t.Fatal(err)
+		}
+		for name, data := range gotFiles {
+			path := filepath.Join(golden, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return
+	}
+	wantFiles, err := readTree(golden, ignore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for name := range gotFiles {
+		names = append(names, name)
+	}
+	for name := range wantFiles {
+		if _, ok := gotFiles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		g, inGot := gotFiles[name]
+		w, inWant := wantFiles[name]
+		switch {
+		case !inWant:
+			t.Errorf("unexpected file %s", name)
+		case !inGot:
+			t.Errorf("missing file %s", name)
+		case string(g) != string(w):
+			t.Errorf("%s differs (-golden +got):\n%s", name, Diff(string(w), string(g)))
+		}
+	}
+}
+
+// readTree reads every file under root, keyed by slash-separated
+// relative path. Symlinks are not followed as directories: a link to a
+// file is read through, one to a directory (a linked module, see
+// Options.Link) is left out.
+func readTree(root string, ignore []string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, pattern := range ignore {
+			if ok, _ := filepath.Match(pattern, d.Name()); ok {
+				return nil
+			}
+			if ok, _ := filepath.Match(pattern, rel); ok {
+				return nil
+			}
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				return nil
+			}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[rel] = data
+		return nil
+	})
+	return files, err
+}
+
+// moduleRoot finds the directory holding the go.mod that governs path.
+func moduleRoot(path string) (string, error) {
+	dir := path
+	if info, err := os.Stat(path); err != nil {
+		return "", err
+	} else if !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("%s is not inside a Go module", path)
+		}
+		dir = parent
+	}
+}
+
+// copyTree copies src into dst, leaving out version control metadata.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
+
+// Diff renders the line differences between want and got, prefixing
+// removed lines with "-" and added ones with "+", with up to three
+// lines of context around each change.
+func Diff(want, got string) string {
+	a := strings.SplitAfter(want, "\n")
+	b := strings.SplitAfter(got, "\n")
+
+	// Longest common subsequence, filled from the end
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, line{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', b[j]})
+			j++
+		}
+	}
+
+	const context = 3
+	var out strings.Builder
+	last := -1
+	for k, l := range lines {
+		if l.op == ' ' {
+			near := false
+			for d := -context; d <= context; d++ {
+				if n := k + d; n >= 0 && n < len(lines) && lines[n].op != ' ' {
+					near = true
+					break
+				}
+			}
+			if !near {
+				continue
+			}
+		}
+		if last >= 0 && k > last+1 {
+			out.WriteString("@@\n")
+		}
+		last = k
+		text := strings.TrimSuffix(l.text, "\n")
+		if l.text == "" {
+			continue
+		}
+		fmt.Fprintf(&out, "%c %s\n", l.op, text)
+	}
+	return out.String()
+}
@@ -0,0 +1,13 @@
+package bradleytest_test
+
+import (
+	"testing"
+
+	"github.com/immanuel-254/bradley/bradleytest"
+	"github.com/immanuel-254/bradley/generate"
+)
+
+func TestGenerate(t *testing.T) {
+	out := bradleytest.Generate(t, "testdata/mylib", generate.Options{})
+	bradleytest.CompareTree(t, out, "testdata/mylib.golden")
+}
@@ -0,0 +1,3 @@
+module mylib_split
+
+go 1.22
@@ -0,0 +1,2 @@
+// Package mylib is split by the bradleytest example test.
+package mylib_split
@@ -0,0 +1,4 @@
+package mylib_split
+
+// Greet returns the greeting for g.
+func (g Greeter) Greet() string { return "Hello, " + Shout(g.Name) }
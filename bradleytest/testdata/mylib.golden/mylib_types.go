@@ -0,0 +1,4 @@
+package mylib_split
+
+// Greeter greets.
+type Greeter struct{ Name string }
@@ -0,0 +1,13 @@
+// Package mylib is split by the bradleytest example test.
+package mylib
+
+import "strings"
+
+// Greeter greets.
+type Greeter struct{ Name string }
+
+// Greet returns the greeting for g.
+func (g Greeter) Greet() string { return "Hello, " + Shout(g.Name) }
+
+// Shout upper-cases s.
+func Shout(s string) string { return strings.ToUpper(s) }
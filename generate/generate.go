@@ -0,0 +1,142 @@
+// Package generate is bradley's public API: it splits a Go package into
+// a new module of kind-bucketed files and shades its dependencies into
+// third_party, as the bradley command does.
+//
+//	g := &generate.Generator{Options: generate.Options{Index: true}}
+//	res, err := g.Generate(ctx, "./mylib")
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Println(res.Module, "written to", res.Dir)
+//
+// # Compatibility
+//
+// Within a major version of the bradley module, nothing exported here is
+// removed or changed incompatibly. Options and Report are the schemas of
+// bradley.json and bradley.report.json: they only gain fields, whose zero
+// value keeps the earlier behavior. Event gains types and fields the same
+// way, so handlers should skip what they do not know. Everything else of
+// bradley is internal and changes without notice.
+package generate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/immanuel-254/bradley/internal/lib"
+)
+
+// Files a run writes into the output besides the split sources.
+const (
+	LockFile    = lib.LockFile
+	ReportFile  = lib.ReportFile
+	IndexFile   = lib.IndexFile
+	OverlayFile = lib.OverlayFile
+)
+
+// Generator runs generations with its Options. Runs in one process are
+// serialized: bradley keeps per-process state while one is in progress.
+type Generator struct {
+	Options Options
+
+	// Events, if set, receives every Event of a run as it happens.
+	Events func(Event)
+
+	// Progress, if set, receives the human-readable progress a run
+	// otherwise prints to stdout.
+	Progress io.Writer
+}
+
+// Result describes the module a run generated.
+type Result struct {
+	Dir     string   // directory of the generated module
+	Module  string   // its module path
+	Files   []string // files written, in order
+	Modules []Module // shaded modules, as bradley.lock records them
+	Report  Report   // as bradley.report.json records it
+}
+
+var running sync.Mutex
+
+// Generate splits inputs, Go files or package directories of one module,
+// into a new module. Several inputs become one package each of a single
+// module named after their module's directory. Cancelling ctx stops the
+// run, killing the go commands it started; an output directory the run
+// created is then removed, and the error is ctx's.
+func (g *Generator) Generate(ctx context.Context, inputs ...string) (*Result, error) {
+	if len(inputs) == 0 {
+		return nil, errors.New("generate: no inputs")
+	}
+	running.Lock()
+	defer running.Unlock()
+
+	res := &Result{}
+	prev := lib.HandleEvents(func(e lib.Event) {
+		if e.Type == "file" {
+			res.Files = append(res.Files, e.File)
+		}
+		if g.Events != nil {
+			g.Events(eventOf(e))
+		}
+	})
+	defer lib.HandleEvents(prev)
+	defer lib.SetProgress(lib.SetProgress(g.progress()))
+
+	err := lib.RunContext(ctx, func() error {
+		var err error
+		res.Dir, res.Module, err = lib.Generate(inputs, g.Options.lib())
+		return err
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lock struct{ Modules []Module }
+	if err := readJSON(filepath.Join(res.Dir, LockFile), &lock); err != nil {
+		return nil, err
+	}
+	res.Modules = lock.Modules
+	if err := readJSON(filepath.Join(res.Dir, ReportFile), &res.Report); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GenerateInMemory splits the package at the root of src, shading the
+// packages it needs from deps, without touching the disk, running the go
+// command or going online. It returns the generated module's files keyed
+// by slash-separated path. Options needing any of these are rejected.
+func (g *Generator) GenerateInMemory(src Source, deps ...Source) (map[string][]byte, error) {
+	running.Lock()
+	defer running.Unlock()
+	defer lib.SetProgress(lib.SetProgress(g.progress()))
+	libDeps := make([]lib.Source, len(deps))
+	for i, dep := range deps {
+		libDeps[i] = dep.lib()
+	}
+	return lib.GenerateInMemory(src.lib(), libDeps, g.Options.lib())
+}
+
+// progress is where g's runs print their progress.
+func (g *Generator) progress() io.Writer {
+	if g.Progress != nil {
+		return g.Progress
+	}
+	return os.Stdout
+}
+
+func readJSON(file string, v any) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,237 @@
+package generate
+
+import (
+	"time"
+
+	"github.com/immanuel-254/bradley/internal/lib"
+)
+
+// Options tweak how the input is split and shaded. They are the schema
+// of bradley.json: a field's json name is its key there.
+type Options struct {
+	MethodsByReceiver bool `json:"by_receiver"`     // one _methods file per receiver type
+	InterfaceFiles    bool `json:"interface_files"` // one file per interface declaration
+	WithImpls         bool `json:"with_impls"`      // with InterfaceFiles, move documented implementations along
+
+	// Files spreads the declarations over this many files of about equal
+	// length (mylib_1.go, ...) in place of the kind buckets, keeping each
+	// type with its methods; zero keeps the kind buckets.
+	Files int `json:"files"`
+
+	ExtractInterfaces []string `json:"extract_interfaces"` // concrete types to emit interfaces.go declarations for
+	InternalHelpers   bool     `json:"internal_helpers"`   // move self-contained unexported funcs to internal/helpers
+
+	// Subpackages maps subpackage names to patterns (path.Match syntax)
+	// selecting the declarations they receive.
+	Subpackages   map[string][]string `json:"subpackages"`
+	CycleStrategy string              `json:"cycles"` // "merge" folds cyclic subpackages together; otherwise cycles are reported
+
+	// Link symlinks modules into third_party from the module cache instead
+	// of copying them. Their imports are checked but left unrewritten, so
+	// the output is for local iteration only.
+	Link bool `json:"link"`
+
+	// SharedThirdParty shades into this directory, a module of its own
+	// named after its base name, instead of each output's third_party, so
+	// several outputs generated from one repo share a single copy.
+	SharedThirdParty string `json:"shared_third_party"`
+
+	// PruneDirs names directories (examples, cmd, ...) dropped from shaded
+	// modules unless a vendored package lives in or embeds them. nil means
+	// DefaultPruneDirs; an empty slice prunes nothing.
+	PruneDirs []string `json:"prune"`
+
+	// FlatThirdParty drops the host from third_party paths
+	// (third_party/pkg/errors rather than third_party/github.com/pkg/errors).
+	FlatThirdParty bool `json:"flat"`
+
+	// Mangle renames the unexported package-level identifiers of shaded
+	// packages and strips their comments and layout, for embedding into
+	// distributed artifacts. Packages using assembly, cgo or linkname are
+	// left as they are.
+	Mangle bool `json:"mangle"`
+
+	// StripComments names the generated code to drop comments from; only
+	// "third_party" is supported. License headers, build constraints and
+	// directives stay.
+	StripComments string `json:"strip_comments"`
+
+	// MaxThirdPartySize fails the run when third_party ends up larger, in
+	// bytes; zero means no limit.
+	MaxThirdPartySize int64 `json:"max_third_party_size"`
+
+	// RewriteStrings points string literals naming a shaded module (error
+	// prefixes, registry keys) at its shaded path; every change is reported.
+	RewriteStrings bool `json:"rewrite_strings"`
+
+	// AllowLicenses and DenyLicenses are SPDX ids (or prefixes such as
+	// "GPL") shaded modules must or must not carry. LicensePolicy "warn"
+	// only reports violations; otherwise they fail the run.
+	AllowLicenses []string `json:"allow_licenses"`
+	DenyLicenses  []string `json:"deny_licenses"`
+	LicensePolicy string   `json:"license_policy"`
+
+	// VerifyPlatforms lists GOOS/GOARCH pairs the generated module must
+	// build for; the run fails if any of them does not.
+	VerifyPlatforms []string `json:"verify_platforms"`
+
+	// HeaderFiles is a glob of generated file names that carry the input's
+	// license banner; "" means all, "-" none. Build constraints are always kept.
+	HeaderFiles string `json:"header_files"`
+
+	// Nested writes the output as a nested module at the root of the
+	// input's module, with a module path beneath it, rather than as a
+	// sibling directory.
+	Nested bool `json:"nested"`
+
+	// Zip is a module version (v1.2.3); when set, the output is also
+	// packaged as the module zip a proxy would serve for it, written next
+	// to the output directory.
+	Zip string `json:"zip"`
+
+	// Namespace is the import path shaded packages are rewritten under
+	// (corp.example.com/shaded/github.com/pkg/errors) in place of
+	// ProjectName/third_party. third_party then becomes a module of that
+	// path, which the output requires through a local replace.
+	Namespace string `json:"namespace"`
+
+	// Tools carries the input module's tool dependencies (go.mod tool
+	// directives, tools.go blank imports) over to the output, pointed at
+	// their shaded copies.
+	Tools bool `json:"tools"`
+
+	// CheckUpstream asks the module proxy whether shaded modules are
+	// deprecated or their versions retracted, warning about each.
+	CheckUpstream bool `json:"check_upstream"`
+
+	// DepsDev adds the latest version, stars and OpenSSF scorecard of
+	// each shaded module, from deps.dev, to the dependency summary.
+	DepsDev bool `json:"deps_dev"`
+
+	// Concurrency caps bradley's simultaneous HTTP requests (default 4),
+	// RateLimit their rate per second (zero is unlimited), and Retries
+	// how often a failed one is retried with backoff (zero means 3,
+	// negative none).
+	Concurrency int     `json:"concurrency"`
+	RateLimit   float64 `json:"rate_limit"`
+	Retries     int     `json:"retries"`
+
+	// Index writes INDEX.md, listing each exported symbol of the output
+	// with the package and file that declare it.
+	Index bool `json:"index"`
+
+	// Overlay splits the input in place, for go build -overlay, rather
+	// than into a new module: OverlayFile, written into the output, lays
+	// the split over the input's package.
+	Overlay bool `json:"overlay"`
+
+	// NoCache turns off the cache of goimports results kept across runs
+	// in the user cache directory.
+	NoCache bool `json:"no_cache"`
+}
+
+// Report records what a run changed beyond moving declarations around,
+// as written to bradley.report.json.
+type Report struct {
+	// RemovedImports lists, per generated file, the imports it was
+	// offered but dropped as unused.
+	RemovedImports map[string][]string `json:"removed_imports,omitempty"`
+
+	// DroppedImports are input imports no generated file kept. A blank
+	// or dot import here means an init side effect is gone.
+	DroppedImports []string `json:"dropped_imports,omitempty"`
+
+	// PathHazards lists shaded packages whose behavior may depend on
+	// their import path, which shading changes, with the reasons why.
+	PathHazards map[string][]string `json:"path_hazards,omitempty"`
+
+	// RewrittenStrings lists the literals -rewrite-strings changed.
+	RewrittenStrings []Rewrite `json:"rewritten_strings,omitempty"`
+
+	// LinknameRewrites lists //go:linkname targets renamed after their
+	// package moved; LinknameWarnings those that could not be fixed.
+	LinknameRewrites []Rewrite `json:"linkname_rewrites,omitempty"`
+	LinknameWarnings []string  `json:"linkname_warnings,omitempty"`
+
+	// LowLevel inventories shaded packages importing unsafe or syscall,
+	// using cgo or containing assembly.
+	LowLevel map[string][]string `json:"low_level,omitempty"`
+
+	// LicenseViolations lists shaded modules breaking the license policy.
+	LicenseViolations []string `json:"license_violations,omitempty"`
+
+	// Dependencies summarizes the shaded modules, largest first.
+	Dependencies []DependencySummary `json:"dependencies,omitempty"`
+
+	// Changes lists how the shaded modules differ from the previous run's
+	// lock, when there was one.
+	Changes []ModuleChange `json:"changes,omitempty"`
+
+	// UpstreamWarnings flags shaded modules deprecated upstream or frozen
+	// at a retracted version.
+	UpstreamWarnings []string `json:"upstream_warnings,omitempty"`
+}
+
+// DependencySummary describes a shaded module in Report.Dependencies.
+type DependencySummary struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Size    int64  `json:"size"`
+	Files   int    `json:"files"`
+	License string `json:"license"`
+
+	// Filled from deps.dev with Options.DepsDev.
+	Latest     string  `json:"latest,omitempty"`
+	Repository string  `json:"repository,omitempty"`
+	Stars      int     `json:"stars,omitempty"`
+	Scorecard  float64 `json:"scorecard,omitempty"`
+	Archived   bool    `json:"archived,omitempty"`
+}
+
+// ModuleChange is a shaded module added, removed or moved to another
+// version since the previous run.
+type ModuleChange struct {
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// Rewrite is a change made in the shaded code: a string literal or a
+// //go:linkname target.
+type Rewrite struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Module is a shaded module at the version it was shaded at.
+type Module struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+// Event is one step of a run: a phase entered, a file written, a warning.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"` // phase, file, warning, error, done
+	Phase   string    `json:"phase,omitempty"`
+	File    string    `json:"file,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// Source is a module held in memory, see Generator.GenerateInMemory.
+type Source struct {
+	Path    string // module path
+	Version string // version, for dependencies
+	Files   map[string][]byte
+}
+
+// The Options, Event and Source of lib have the same fields as these:
+// conversions between them do not compile once they drift apart.
+
+func (o Options) lib() lib.Options { return lib.Options(o) }
+
+func (s Source) lib() lib.Source { return lib.Source(s) }
+
+func eventOf(e lib.Event) Event { return Event(e) }
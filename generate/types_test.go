@@ -0,0 +1,37 @@
+package generate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/immanuel-254/bradley/internal/lib"
+)
+
+// TestSchemas checks the types read back from bradley.lock and
+// bradley.report.json against those bradley writes them from, which,
+// unlike Options, Event and Source, conversions cannot keep in step.
+func TestSchemas(t *testing.T) {
+	pairs := []struct{ public, internal any }{
+		{Report{}, lib.Report{}},
+		{DependencySummary{}, lib.DependencySummary{}},
+		{ModuleChange{}, lib.ModuleChange{}},
+		{Rewrite{}, lib.Rewrite{}},
+		{Module{}, lib.LockedModule{}},
+	}
+	for _, p := range pairs {
+		pub, in := reflect.TypeOf(p.public), reflect.TypeOf(p.internal)
+		if got, want := jsonFields(pub), jsonFields(in); !reflect.DeepEqual(got, want) {
+			t.Errorf("%v has the JSON fields\n%v\nwant those of %v\n%v", pub, got, in, want)
+		}
+	}
+}
+
+// jsonFields maps the JSON names of t's fields to their Go kinds.
+func jsonFields(t reflect.Type) map[string]reflect.Kind {
+	fields := map[string]reflect.Kind{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		fields[f.Tag.Get("json")] = f.Type.Kind()
+	}
+	return fields
+}
@@ -1,10 +1,10 @@
-module bradley
+module github.com/immanuel-254/bradley
 
 go 1.25.4
 
-require golang.org/x/tools v0.41.0
-
 require (
-	golang.org/x/mod v0.32.0 // indirect
-	golang.org/x/sync v0.19.0 // indirect
+	golang.org/x/mod v0.32.0
+	golang.org/x/tools v0.41.0
 )
+
+require golang.org/x/sync v0.19.0 // indirect
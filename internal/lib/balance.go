@@ -0,0 +1,96 @@
+package lib
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// 39. BALANCED FILES
+// ---------------------------------------------------------
+
+// balanceDecls distributes decls over n groups of roughly equal line
+// counts, for Options.Files. A type declaration and its methods are
+// never separated. Each group keeps its declarations in source order,
+// and the groups are ordered by their first declaration.
+func (g *Generator) balanceDecls(decls []ast.Decl, n int) [][]ast.Decl {
+	// A type and its methods form one unit, wherever the methods appear
+	var units [][]ast.Decl
+	unitOf := map[string]int{}
+	for _, decl := range decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.TYPE {
+			for _, spec := range d.Specs {
+				unitOf[spec.(*ast.TypeSpec).Name.Name] = len(units)
+			}
+			units = append(units, []ast.Decl{decl})
+		}
+	}
+	for _, decl := range decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok == token.TYPE {
+				continue
+			}
+		case *ast.FuncDecl:
+			if d.Recv != nil {
+				if u, ok := unitOf[receiverName(d)]; ok {
+					units[u] = append(units[u], decl)
+					continue
+				}
+			}
+		}
+		units = append(units, []ast.Decl{decl})
+	}
+	if len(units) < n {
+		if len(units) > 0 {
+			warnf("Only %d declaration groups to spread over %d files", len(units), n)
+		}
+		n = len(units)
+	}
+
+	// Largest first, each into the lightest file so far
+	sizes := make([]int, len(units))
+	order := make([]int, len(units))
+	for i, unit := range units {
+		for _, decl := range unit {
+			sizes[i] += g.lineCount(decl)
+		}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return sizes[order[i]] > sizes[order[j]] })
+	groups := make([][]ast.Decl, n)
+	load := make([]int, n)
+	for _, u := range order {
+		lightest := 0
+		for i := range load {
+			if load[i] < load[lightest] {
+				lightest = i
+			}
+		}
+		groups[lightest] = append(groups[lightest], units[u]...)
+		load[lightest] += sizes[u]
+	}
+
+	for _, group := range groups {
+		sort.SliceStable(group, func(i, j int) bool { return group[i].Pos() < group[j].Pos() })
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i][0].Pos() < groups[j][0].Pos() })
+	return groups
+}
+
+// lineCount is the number of source lines decl spans, doc comment
+// included.
+func (g *Generator) lineCount(decl ast.Decl) int {
+	start := decl.Pos()
+	switch d := decl.(type) {
+	case *ast.GenDecl:
+		if d.Doc != nil {
+			start = d.Doc.Pos()
+		}
+	case *ast.FuncDecl:
+		if d.Doc != nil {
+			start = d.Doc.Pos()
+		}
+	}
+	return g.Fset.Position(decl.End()).Line - g.Fset.Position(start).Line + 1
+}
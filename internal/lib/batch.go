@@ -0,0 +1,94 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// 37. BATCHES
+// ---------------------------------------------------------
+
+// newBatch returns the generator of a batch, named after the directory of
+// the inputs' module.
+func newBatch(inputs []string, opts Options) (*Generator, error) {
+	root, _, err := enclosingModule(inputs[0])
+	if err != nil {
+		return nil, err
+	}
+	return newGenerator(commandName(root), "", opts), nil
+}
+
+// generateBatch splits several inputs of one module in a single run. The
+// output module is named after the module's directory (myrepo_split) and
+// holds one package per input, named as its own run would name it
+// (myrepo_split/mylib_split), all sharing one go.mod and one third_party.
+// Imports between the inputs point at their split packages.
+func (g *Generator) generateBatch(inputs []string) (err error) {
+	if g.Overlay {
+		return fmt.Errorf("overlay: lays one package over its module; split the inputs one at a time")
+	}
+	root, _, err := enclosingModule(inputs[0])
+	if err != nil {
+		return err
+	}
+	release, err := g.prepare(inputs...)
+	if err != nil {
+		return err
+	}
+	defer release(&err)
+	fmt.Fprintf(progress(), "🚀 Starting generation for %s (%d inputs)...\n", g.ProjectName, len(inputs))
+
+	phase("load")
+	g.moved = map[string]string{}
+	g.keptImports, g.offeredImports = map[string]bool{}, map[string]bool{}
+	parts := make([]*Generator, len(inputs))
+	pkgs := make([]*inputPackage, len(inputs))
+	taken := map[string]bool{}
+	for i, input := range inputs {
+		if dir, _, err := enclosingModule(input); err != nil {
+			return err
+		} else if dir != root {
+			return fmt.Errorf("%s is not in the module at %s; a batch splits inputs of one module", input, root)
+		}
+
+		p := NewGenerator(input, g.Options)
+		name := p.ProjectName
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s%d", p.ProjectName, n)
+		}
+		taken[name] = true
+		p.OutputDir = filepath.Join(g.OutputDir, name)
+		p.ProjectName = importPath(g.ProjectName, name)
+		p.ThirdPartyDir, p.ImportPrefix = g.ThirdPartyDir, g.ImportPrefix
+		p.report, p.net, p.moved = g.report, g.net, g.moved
+		p.keptImports, p.offeredImports = g.keptImports, g.offeredImports
+		p.backups = g.backups
+
+		// Every input is loaded before any is written, so each knows
+		// where the others end up
+		if pkgs[i], err = p.loadInput(input); err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+		if pkgs[i].ImportPath != "" {
+			g.moved[pkgs[i].ImportPath] = p.ProjectName
+		}
+		parts[i] = p
+	}
+
+	phase("write")
+	os.MkdirAll(g.OutputDir, 0755)
+	for i, p := range parts {
+		if err := checkInterrupt(); err != nil {
+			return err
+		}
+		if err := p.writeSplit(inputs[i], pkgs[i]); err != nil {
+			return fmt.Errorf("%s: %w", inputs[i], err)
+		}
+		for _, name := range p.created {
+			g.created = append(g.created, path.Join(filepath.Base(p.OutputDir), name))
+		}
+	}
+	return g.finish(inputs...)
+}
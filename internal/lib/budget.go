@@ -0,0 +1,133 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 16. SIZE BUDGET
+// ---------------------------------------------------------
+
+// moduleSizes totals the bytes and files each shaded module takes up
+// under third_party. Linked files count at the size of their targets.
+func (g *Generator) moduleSizes() (sizes map[string]int64, files map[string]int, total int64, err error) {
+	sizes, files = map[string]int64{}, map[string]int{}
+	if g.memory != nil {
+		for name, data := range g.memory {
+			if rel, ok := strings.CutPrefix(name, "third_party/"); ok {
+				mod := g.moduleAt(rel)
+				sizes[mod] += int64(len(data))
+				files[mod]++
+				total += int64(len(data))
+			}
+		}
+		return sizes, files, total, nil
+	}
+	root := longPathRoot(g.ThirdPartyDir)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if info, err = os.Stat(path); err != nil {
+				return err
+			}
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		mod := g.moduleAt(slashPath(rel))
+		sizes[mod] += info.Size()
+		files[mod]++
+		total += info.Size()
+		return nil
+	})
+	return sizes, files, total, err
+}
+
+// checkBudget fails when third_party exceeds MaxThirdPartySize, ranking
+// the modules that take up the space.
+func (g *Generator) checkBudget() error {
+	sizes, _, total, err := g.moduleSizes()
+	if err != nil {
+		return err
+	}
+	if total <= g.MaxThirdPartySize {
+		return nil
+	}
+
+	mods := make([]string, 0, len(sizes))
+	for mod := range sizes {
+		mods = append(mods, mod)
+	}
+	sort.Slice(mods, func(i, j int) bool {
+		if sizes[mods[i]] != sizes[mods[j]] {
+			return sizes[mods[i]] > sizes[mods[j]]
+		}
+		return mods[i] < mods[j]
+	})
+	var b strings.Builder
+	fmt.Fprintf(&b, "third_party is %s, over the %s budget; largest modules:\n", formatSize(total), formatSize(g.MaxThirdPartySize))
+	for i, mod := range mods {
+		if i == 10 {
+			fmt.Fprintf(&b, "  ... and %d more\n", len(mods)-i)
+			break
+		}
+		fmt.Fprintf(&b, "  %9s  %s\n", formatSize(sizes[mod]), mod)
+	}
+	b.WriteString("to shrink it: -strip-comments=third_party, -prune more directories, -mangle, or drop or replace the largest dependencies")
+	return fmt.Errorf("%s", b.String())
+}
+
+// moduleAt finds the shaded module holding a path relative to
+// third_party, going by the layout planned for this run.
+func (g *Generator) moduleAt(rel string) string {
+	best, bestRoot := "", ""
+	for mod, root := range g.layout {
+		if hasPathPrefix(rel, root) && len(root) > len(bestRoot) {
+			best, bestRoot = mod, root
+		}
+	}
+	if best == "" {
+		return "(other)"
+	}
+	return best
+}
+
+// ParseSize reads a size such as "512K", "200MB" or "1.5GiB"; units are
+// powers of 1024 and a bare number is bytes.
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mult := int64(1)
+	for i, unit := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(s, unit) {
+			mult = 1 << (10 * (i + 1))
+			s = strings.TrimSuffix(s, unit)
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad size %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGT"[exp])
+}
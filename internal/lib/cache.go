@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/imports"
+)
+
+// 36. IMPORTS CACHE
+// ---------------------------------------------------------
+
+// importsVersion identifies the goimports implementation, whose output
+// is only reusable from the same version.
+var importsVersion = sync.OnceValue(func() string {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range bi.Deps {
+			if dep.Path == "golang.org/x/tools" {
+				return dep.Version
+			}
+		}
+	}
+	return ""
+})
+
+// goCommandVersion is the version of the go command goimports consults to
+// resolve imports, "" when there is none.
+var goCommandVersion = sync.OnceValue(func() string {
+	v, _ := cmdOutput("", "go", "env", "GOVERSION")
+	return v
+})
+
+// Bounds of the imports cache: entries unused for importsCacheMaxAge go,
+// and the least recently used beyond importsCacheMaxSize.
+const (
+	importsCacheMaxAge  = 30 * 24 * time.Hour
+	importsCacheMaxSize = 256 << 20
+)
+
+// importsCacheDir holds processed files named by the hash of their input,
+// or is "" when there is no user cache directory. It is trimmed once per
+// process, see trimImportsCache.
+var importsCacheDir = sync.OnceValue(func() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	dir = filepath.Join(dir, "bradley", "imports")
+	trimImportsCache(dir, importsCacheMaxAge, importsCacheMaxSize)
+	return dir
+})
+
+// trimImportsCache removes the entries of dir not used for maxAge, then
+// the least recently used ones until the rest fit in maxSize. A hit
+// refreshes its entry's time.
+func trimImportsCache(dir string, maxAge time.Duration, maxSize int64) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	type entry struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var kept []entry
+	var total int64
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		if time.Since(info.ModTime()) > maxAge {
+			os.Remove(p)
+			continue
+		}
+		kept = append(kept, entry{p, info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+	slices.SortFunc(kept, func(a, b entry) int { return a.used.Compare(b.used) })
+	for _, e := range kept {
+		if total <= maxSize {
+			break
+		}
+		if os.Remove(e.path) == nil {
+			total -= e.size
+		}
+	}
+}
+
+// moduleFileOf returns the content of the go.mod governing dir, which
+// goimports resolves the imports of a file in dir against.
+func moduleFileOf(dir string) []byte {
+	for {
+		if data, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+			return data
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// processImports runs imports.Process on src, reusing the result of an
+// earlier run for the same file name, content, goimports and go version
+// and go.mod, so regenerating leaves unchanged buckets alone. Without
+// NoCache results are cached across runs; cache trouble only costs the
+// reuse.
+func (g *Generator) processImports(filename string, src []byte) ([]byte, error) {
+	dir := importsCacheDir()
+	if g.NoCache || dir == "" {
+		return imports.Process(filename, src, nil)
+	}
+	abs, _ := filepath.Abs(filename)
+	h := sha256.New()
+	gomod := sha256.Sum256(moduleFileOf(filepath.Dir(abs)))
+	for _, part := range []string{importsVersion(), goCommandVersion(), hex.EncodeToString(gomod[:]), abs, "options=nil"} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(src)
+	entry := filepath.Join(dir, hex.EncodeToString(h.Sum(nil)))
+
+	if out, err := os.ReadFile(entry); err == nil {
+		now := time.Now()
+		os.Chtimes(entry, now, now) // Recently used, see trimImportsCache
+		return out, nil
+	}
+	out, err := imports.Process(filename, src, nil)
+	if err != nil {
+		return nil, err
+	}
+	if os.MkdirAll(dir, 0755) == nil {
+		// Rename into place so concurrent runs never read half an entry
+		if tmp, err := os.CreateTemp(dir, "tmp-"); err == nil {
+			_, werr := tmp.Write(out)
+			if cerr := tmp.Close(); werr == nil && cerr == nil && os.Rename(tmp.Name(), entry) == nil {
+				return out, nil
+			}
+			os.Remove(tmp.Name())
+		}
+	}
+	return out, nil
+}
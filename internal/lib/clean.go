@@ -0,0 +1,83 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// 49. CLEAN
+// ---------------------------------------------------------
+
+// Clean removes from dir, the output of an earlier run, the files it
+// created as bradley.lock lists them, one by one, then the lock, report
+// and changelog. Directories are removed only once nothing is left in
+// them, so files added by hand stay where they are, along with the
+// directories holding them.
+func Clean(dir string) error {
+	data, err := os.ReadFile(filepath.Join(dir, LockFile))
+	if err != nil {
+		return fmt.Errorf("no %s in %s to clean by: %w", LockFile, dir, err)
+	}
+	var lock Lock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return fmt.Errorf("%s: %w", LockFile, err)
+	}
+	if len(lock.Files) == 0 {
+		return fmt.Errorf("%s lists no files; it predates bradley clean, so regenerate before cleaning", filepath.Join(dir, LockFile))
+	}
+	for _, name := range lock.Files {
+		if !isLocalSlash(name) {
+			return fmt.Errorf("%s: %q is not inside the output", LockFile, name)
+		}
+	}
+
+	release, err := (&Generator{OutputDir: dir}).lockOutput()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	removed, err := removeFiles(dir, slices.Concat(lock.Files, []string{ReportFile, ChangelogFile, LockFile}))
+	if err != nil {
+		return err
+	}
+	kept := os.Remove(dir) != nil
+
+	fmt.Fprintf(progress(), "🧹 Removed %d generated files from %s\n", removed, dir)
+	if kept {
+		fmt.Fprintf(progress(), "📁 Kept %s: it holds files bradley did not write\n", dir)
+	}
+	return nil
+}
+
+// removeFiles removes the files names, slash-separated and relative to
+// dir, one by one, then the directories under dir they leave empty. It
+// returns how many files it removed.
+func removeFiles(dir string, names []string) (int, error) {
+	removed := 0
+	parents := map[string]bool{}
+	for _, name := range names {
+		target := diskPath(dir, name)
+		if err := os.Remove(longPath(target)); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return removed, err
+		}
+		removed++
+		for p := filepath.Dir(target); p != filepath.Clean(dir); p = filepath.Dir(p) {
+			parents[p] = true
+		}
+	}
+
+	// Deepest first, so a directory emptied by its children goes too
+	dirs := slices.Collect(maps.Keys(parents))
+	slices.SortFunc(dirs, func(a, b string) int { return len(b) - len(a) })
+	for _, p := range dirs {
+		os.Remove(longPath(p)) // Fails, as it should, when files are left there
+	}
+	return removed, nil
+}
@@ -0,0 +1,73 @@
+package lib
+
+import (
+	"encoding/json"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	lock, err := json.Marshal(Lock{Files: []string{
+		"go.mod",
+		"p_types.go",
+		"third_party/example.com/m/m.go",
+		"third_party/example.com/old/old.go",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, map[string]string{
+		LockFile:                             string(lock),
+		"go.mod":                             "module out\n",
+		"p_types.go":                         "package p\n",
+		"notes.txt":                          "added by hand\n",
+		"third_party/example.com/m/m.go":     "package m\n",
+		"third_party/example.com/m/local.go": "package m\n",
+		"third_party/example.com/old/old.go": "package old\n",
+	})
+
+	if err := Clean(dir); err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, p := range slices.Sorted(maps.Keys(treeSums(t, dir))) {
+		rel, _ := filepath.Rel(dir, p)
+		left = append(left, filepath.ToSlash(rel))
+	}
+	want := []string{"notes.txt", "third_party/example.com/m/local.go"}
+	if !slices.Equal(left, want) {
+		t.Errorf("left %v, want %v", left, want)
+	}
+}
+
+func TestRemoveStale(t *testing.T) {
+	dir := t.TempDir()
+	lock, err := json.Marshal(Lock{Files: []string{"go.mod", "p_methods.go", "p_types.go", "third_party/m/m.go"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, dir, map[string]string{
+		LockFile:              string(lock),
+		"go.mod":              "module out\n",
+		"p_methods.go":        "package p\n",
+		"p_server_methods.go": "package p\n",
+		"p_types.go":          "package p\n",
+		"third_party/m/m.go":  "package m\n",
+	})
+	g := &Generator{OutputDir: dir, created: []string{"go.mod", "p_server_methods.go", "p_types.go"}}
+	if err := g.removeStale(); err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, p := range slices.Sorted(maps.Keys(treeSums(t, dir))) {
+		rel, _ := filepath.Rel(dir, p)
+		left = append(left, filepath.ToSlash(rel))
+	}
+	want := []string{LockFile, "go.mod", "p_server_methods.go", "p_types.go"}
+	if !slices.Equal(left, want) {
+		t.Errorf("left %v, want %v", left, want)
+	}
+}
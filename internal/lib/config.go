@@ -0,0 +1,256 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+)
+
+// 18. CONFIGURATION
+// ---------------------------------------------------------
+
+// ConfigFile is the conventional name of a bradley configuration.
+const ConfigFile = "bradley.json"
+
+// Config is a generation run written down: the input plus the options
+// the command-line flags would otherwise set. Flags given alongside a
+// config override it.
+type Config struct {
+	Input string `json:"input"`
+	Options
+
+	// Publish holds the defaults of "bradley publish".
+	Publish PublishOptions `json:"publish"`
+
+	// Profiles are named variants of the options: each holds the keys it
+	// changes, applied over the top-level options, see Profile.
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+
+	dir string // directory of the file, for relative paths in profiles
+}
+
+// Profile returns the options of the named profile: the top-level
+// options with the profile's keys applied over them.
+func (c Config) Profile(name string) (Options, error) {
+	raw, ok := c.Profiles[name]
+	if !ok {
+		return Options{}, fmt.Errorf("no profile %q", name)
+	}
+	if !profileName.MatchString(name) {
+		return Options{}, fmt.Errorf("bad profile name %q", name)
+	}
+	// Round-trip the base so the profile shares no slices or maps with it
+	base, err := json.Marshal(c.Options)
+	if err != nil {
+		return Options{}, err
+	}
+	var opts Options
+	if err := json.Unmarshal(base, &opts); err != nil {
+		return Options{}, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&opts); err != nil {
+		return Options{}, fmt.Errorf("profile %s: %w", name, err)
+	}
+	var own Options // The base's paths are resolved already
+	json.Unmarshal(raw, &own)
+	if own.SharedThirdParty != "" && !filepath.IsAbs(own.SharedThirdParty) {
+		opts.SharedThirdParty = filepath.Join(c.dir, own.SharedThirdParty)
+	}
+	return opts, nil
+}
+
+// LoadConfig reads a config file, rejecting unknown fields so a typo in
+// a key fails here rather than being silently ignored. Relative paths in
+// it are taken relative to the file.
+func LoadConfig(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	dir := filepath.Dir(file)
+	cfg.dir = dir
+	if cfg.Input != "" && !filepath.IsAbs(cfg.Input) {
+		cfg.Input = filepath.Join(dir, cfg.Input)
+	}
+	if cfg.SharedThirdParty != "" && !filepath.IsAbs(cfg.SharedThirdParty) {
+		cfg.SharedThirdParty = filepath.Join(dir, cfg.SharedThirdParty)
+	}
+	return &cfg, nil
+}
+
+// Resolved fills in the defaults a run would apply, giving the effective
+// configuration.
+func (c Config) Resolved() Config {
+	if c.CycleStrategy == "" {
+		c.CycleStrategy = "report"
+	}
+	if c.PruneDirs == nil {
+		c.PruneDirs = DefaultPruneDirs
+	}
+	return c
+}
+
+// Validate checks values against what a run accepts and that the paths
+// and modules the config refers to exist, so mistakes surface before a
+// long generation. It returns every problem found.
+func (c Config) Validate() []error {
+	errs := validateOptions(c.Options)
+	for _, name := range slices.Sorted(maps.Keys(c.Profiles)) {
+		opts, err := c.Profile(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("profiles: %w", err))
+			continue
+		}
+		for _, err := range validateOptions(opts) {
+			errs = append(errs, fmt.Errorf("profiles: %s: %w", name, err))
+		}
+	}
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	if v := c.Publish.Version; v != "" && (!semver.IsValid(v) || semver.Canonical(v) != v) {
+		fail("publish: version %q is not a canonical semantic version", v)
+	}
+	if c.Publish.Remote != "" && c.Publish.Proxy != "" {
+		fail("publish: remote and proxy are exclusive")
+	}
+
+	if c.Input == "" {
+		fail("input: missing")
+		return errs
+	}
+	info, err := os.Stat(c.Input)
+	if err != nil {
+		fail("input: %v", err)
+		return errs
+	}
+	dir := c.Input
+	if !info.IsDir() {
+		dir = filepath.Dir(c.Input)
+	}
+	if _, err := cmdOutput(dir, "go", "list", "-m"); err != nil {
+		fail("input: %s is not inside a Go module", c.Input)
+		return errs
+	}
+	if _, err := cmdOutput(dir, "go", "list", "-deps", "."); err != nil {
+		fail("input: dependencies of %s do not resolve (try go mod download)", c.Input)
+	}
+	return errs
+}
+
+// validateOptions checks option values against what a run accepts.
+func validateOptions(o Options) []error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch o.CycleStrategy {
+	case "", "report", "merge":
+	default:
+		fail(`cycles: %q is neither "report" nor "merge"`, o.CycleStrategy)
+	}
+	switch o.StripComments {
+	case "", "third_party":
+	default:
+		fail(`strip_comments: only "third_party" is supported, not %q`, o.StripComments)
+	}
+	switch o.LicensePolicy {
+	case "", "fail", "warn":
+	default:
+		fail(`license_policy: %q is neither "fail" nor "warn"`, o.LicensePolicy)
+	}
+	for sub, patterns := range o.Subpackages {
+		if !token.IsIdentifier(sub) {
+			fail("subpackages: bad subpackage name %q", sub)
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				fail("subpackages: %s: bad pattern %q", sub, pattern)
+			}
+		}
+	}
+	if o.HeaderFiles != "" && o.HeaderFiles != "-" {
+		if _, err := filepath.Match(o.HeaderFiles, ""); err != nil {
+			fail("header_files: bad glob %q", o.HeaderFiles)
+		}
+	}
+	for _, dir := range o.PruneDirs {
+		if dir == "" || strings.ContainsAny(dir, `/\`) {
+			fail("prune: %q is not a directory name", dir)
+		}
+	}
+	for _, platform := range o.VerifyPlatforms {
+		goos, goarch, _ := strings.Cut(platform, "/")
+		if goos == "tinygo" && goarch != "" {
+			continue // TinyGo targets are TinyGo's to check
+		}
+		if !knownOS[goos] || !knownArch[goarch] {
+			fail("verify_platforms: unknown platform %q", platform)
+		}
+	}
+	if o.Concurrency < 0 {
+		fail("concurrency: negative")
+	}
+	if o.RateLimit < 0 {
+		fail("rate_limit: negative")
+	}
+	if o.MaxThirdPartySize < 0 {
+		fail("max_third_party_size: negative size")
+	}
+	if o.Files < 0 {
+		fail("files: negative")
+	}
+	if o.Files > 0 && (o.MethodsByReceiver || o.InterfaceFiles) {
+		fail("files: replaces the buckets by_receiver and interface_files lay out")
+	}
+	if o.Files == 1 && o.InternalHelpers {
+		fail("files: internal_helpers takes one of the files, so it needs at least 2")
+	}
+	if o.WithImpls && !o.InterfaceFiles {
+		fail("with_impls: needs interface_files")
+	}
+	if o.Link && o.Mangle {
+		fail("mangle: linked modules cannot be mangled")
+	}
+	if o.Zip != "" {
+		if !semver.IsValid(o.Zip) || semver.Canonical(o.Zip) != o.Zip {
+			fail("zip: %q is not a canonical semantic version", o.Zip)
+		}
+		if o.Link || o.SharedThirdParty != "" || o.Namespace != "" {
+			fail("zip: linked, shared or namespaced third_party is not part of the module")
+		}
+	}
+	if o.Overlay && (o.Nested || o.Zip != "" || o.Link || o.SharedThirdParty != "" || o.Namespace != "" || o.Tools) {
+		fail("overlay: excludes nested, zip, link, shared_third_party, namespace and tools")
+	}
+	if o.Namespace != "" {
+		if err := module.CheckImportPath(o.Namespace); err != nil {
+			fail("namespace: %v", err)
+		}
+	}
+	if o.SharedThirdParty != "" {
+		if info, err := os.Stat(filepath.Dir(filepath.Clean(o.SharedThirdParty))); err != nil || !info.IsDir() {
+			fail("shared_third_party: parent of %s does not exist", o.SharedThirdParty)
+		}
+	}
+	return errs
+}
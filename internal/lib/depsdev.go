@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// 34. DEPS.DEV METADATA
+// ---------------------------------------------------------
+
+// depsDevAPI is the deps.dev API the report is enriched from.
+var depsDevAPI = "https://api.deps.dev/v3"
+
+// enrichDependencies fills in the latest version, GitHub stars and
+// OpenSSF scorecard of each shaded module from deps.dev, and warns about
+// modules whose repository is archived. Lookups that fail leave the
+// fields empty.
+func (g *Generator) enrichDependencies(deps []DependencySummary) {
+	errs := make([]error, len(deps))
+	var wg sync.WaitGroup
+	for i := range deps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = deps[i].enrich(g.net)
+		}()
+	}
+	wg.Wait()
+
+	for i, d := range deps {
+		if errs[i] != nil {
+			warnf("No deps.dev metadata for %s: %v", d.Path, errs[i])
+			continue
+		}
+		if d.Archived {
+			warning := fmt.Sprintf("%s is archived upstream", d.Path)
+			warnf("%s", warning)
+			g.report.UpstreamWarnings = append(g.report.UpstreamWarnings, warning)
+		}
+	}
+}
+
+func (d *DependencySummary) enrich(n *network) error {
+	pkg := depsDevAPI + "/systems/go/packages/" + url.PathEscape(d.Path)
+	var versions struct {
+		Versions []struct {
+			VersionKey struct{ Version string }
+			IsDefault  bool
+		}
+	}
+	if err := n.getJSON(pkg, &versions); err != nil {
+		return err
+	}
+	for _, v := range versions.Versions {
+		if v.IsDefault {
+			d.Latest = v.VersionKey.Version
+		}
+	}
+
+	var version struct {
+		RelatedProjects []struct {
+			ProjectKey   struct{ ID string }
+			RelationType string
+		}
+	}
+	if err := n.getJSON(pkg+"/versions/"+url.PathEscape(d.Version), &version); err != nil {
+		return err
+	}
+	for _, p := range version.RelatedProjects {
+		if p.RelationType != "SOURCE_REPO" {
+			continue
+		}
+		var project struct {
+			StarsCount int
+			Scorecard  *struct {
+				OverallScore float64
+				Checks       []struct {
+					Name   string
+					Reason string
+				}
+			}
+		}
+		if err := n.getJSON(depsDevAPI+"/projects/"+url.PathEscape(p.ProjectKey.ID), &project); err != nil {
+			return err
+		}
+		d.Repository = p.ProjectKey.ID
+		d.Stars = project.StarsCount
+		if sc := project.Scorecard; sc != nil {
+			d.Scorecard = sc.OverallScore
+			for _, c := range sc.Checks {
+				if c.Name == "Maintained" && strings.Contains(c.Reason, "archived") {
+					d.Archived = true
+				}
+			}
+		}
+		break
+	}
+	return nil
+}
+
+// getJSON GETs target and decodes its JSON body into v.
+func (n *network) getJSON(target string, v any) error {
+	data, err := n.fetch(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
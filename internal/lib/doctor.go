@@ -0,0 +1,207 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/version"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/modfile"
+)
+
+// 48. DOCTOR
+// ---------------------------------------------------------
+
+// minGoVersion is the oldest go command bradley runs: older ones reject
+// the tool directives of Go 1.24 go.mod files.
+const minGoVersion = "go1.24"
+
+// Check is one finding of Doctor: what was looked at, what was found,
+// and for a failure how to fix it.
+type Check struct {
+	Name   string
+	OK     bool
+	Detail string
+	Fix    string
+}
+
+// Doctor checks the environment a run in dir needs: the go command and
+// its version, module mode, the module proxy, the module cache, write
+// access for the output and scratch directories, and the config file
+// (configFile, or bradley.json in dir when it exists).
+func Doctor(dir, configFile string) []Check {
+	checks := []Check{checkToolchain(dir)}
+	if !checks[0].OK && checks[0].Detail == "" {
+		return checks // Without a go command there is nothing more to ask
+	}
+	return append(checks,
+		checkModuleMode(dir),
+		checkProxy(),
+		checkModCache(),
+		checkWritable("output directory", dir, "run bradley from a directory you can write to, or make this one writable"),
+		checkWritable("scratch directory", os.TempDir(), "point TMPDIR at a writable directory"),
+		checkConfig(dir, configFile),
+	)
+}
+
+func checkToolchain(dir string) Check {
+	c := Check{Name: "go toolchain"}
+	v, err := cmdOutput(dir, "go", "env", "GOVERSION")
+	if err != nil {
+		c.Fix = "install Go (https://go.dev/dl) and put the go command on PATH"
+		return c
+	}
+	c.Detail = v
+	if version.Compare(v, minGoVersion) < 0 {
+		c.Fix = fmt.Sprintf("upgrade Go to %s or later", strings.TrimPrefix(minGoVersion, "go"))
+		return c
+	}
+	if gomod, _ := cmdOutput(dir, "go", "env", "GOMOD"); gomod != "" && gomod != os.DevNull {
+		if data, err := os.ReadFile(gomod); err == nil {
+			if mf, err := modfile.ParseLax(gomod, data, nil); err == nil && mf.Go != nil &&
+				version.Compare("go"+mf.Go.Version, v) > 0 {
+				c.Detail += fmt.Sprintf(", but %s needs go %s", gomod, mf.Go.Version)
+				c.Fix = "upgrade Go, or set GOTOOLCHAIN=auto to let the go command fetch the toolchain the module needs"
+				return c
+			}
+		}
+	}
+	c.OK = true
+	return c
+}
+
+func checkModuleMode(dir string) Check {
+	c := Check{Name: "module mode"}
+	if mode, _ := cmdOutput(dir, "go", "env", "GO111MODULE"); mode == "off" {
+		c.Detail = "GO111MODULE=off"
+		c.Fix = "run go env -u GO111MODULE (or unset it): bradley vendors through modules"
+		return c
+	}
+	gomod, _ := cmdOutput(dir, "go", "env", "GOMOD")
+	if gomod == "" || gomod == os.DevNull {
+		c.Detail = "not inside a module"
+		c.Fix = "run bradley inside the module of the package to split, or create one with go mod init"
+		return c
+	}
+	c.OK, c.Detail = true, gomod
+	return c
+}
+
+func checkProxy() Check {
+	c := Check{Name: "module proxy"}
+	proxies, _ := cmdOutput("", "go", "env", "GOPROXY")
+	c.Detail = "GOPROXY=" + proxies
+	var proxy string
+	for _, p := range strings.FieldsFunc(proxies, func(r rune) bool { return r == ',' || r == '|' }) {
+		if p == "off" {
+			c.OK = true
+			c.Detail += ": modules missing from the cache cannot be fetched"
+			return c
+		}
+		if p != "direct" {
+			proxy = p
+			break
+		}
+	}
+	if proxy == "" {
+		c.OK = true
+		c.Detail += ": modules are fetched from their origin, not checked"
+		return c
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := RunContext(ctx, func() error {
+		_, err := newNetwork(Options{Retries: -1}).fetch("GET", strings.TrimSuffix(proxy, "/")+"/golang.org/x/mod/@latest", nil)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = fmt.Errorf("no answer from %s within 10s", proxy)
+		}
+		c.Detail += ": " + err.Error()
+		c.Fix = "check the network and proxy settings (HTTPS_PROXY), or set GOPROXY to a reachable proxy, or to off to work from the module cache"
+		return c
+	}
+	c.OK = true
+	return c
+}
+
+func checkModCache() Check {
+	c := Check{Name: "module cache"}
+	cache, _ := cmdOutput("", "go", "env", "GOMODCACHE")
+	c.Detail = cache
+	if cache == "" {
+		c.Fix = "set GOMODCACHE, or GOPATH, to a writable directory"
+		return c
+	}
+	if err := os.MkdirAll(cache, 0755); err != nil {
+		c.Detail = err.Error()
+		c.Fix = "set GOMODCACHE to a writable directory"
+		return c
+	}
+	// The cache is read-only below the top; downloads still need the
+	// top writable
+	if err := probeWrite(cache); err != nil {
+		c.Detail = err.Error()
+		c.Fix = "make " + cache + " writable, or set GOMODCACHE to a writable directory"
+		return c
+	}
+	c.OK = true
+	return c
+}
+
+func checkWritable(name, dir, fix string) Check {
+	c := Check{Name: name}
+	abs, err := filepath.Abs(dir)
+	if err == nil {
+		c.Detail = abs
+		err = probeWrite(abs)
+	}
+	if err != nil {
+		c.Detail = err.Error()
+		c.Fix = fix
+		return c
+	}
+	c.OK = true
+	return c
+}
+
+// probeWrite creates and removes a file in dir.
+func probeWrite(dir string) error {
+	f, err := os.CreateTemp(dir, ".bradley-doctor-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func checkConfig(dir, file string) Check {
+	c := Check{Name: "config"}
+	if file == "" {
+		file = filepath.Join(dir, ConfigFile)
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			c.OK, c.Detail = true, "no "+ConfigFile
+			return c
+		}
+	}
+	c.Detail = file
+	cfg, err := LoadConfig(file)
+	if err != nil {
+		c.Detail = err.Error()
+		c.Fix = "fix the JSON of " + file + "; its fields are those of bradley config validate's output"
+		return c
+	}
+	if errs := cfg.Validate(); len(errs) > 0 {
+		c.Detail = file + ": " + errors.Join(errs...).Error()
+		c.Fix = "correct the listed options; bradley config validate -config " + file + " rechecks them"
+		return c
+	}
+	c.OK = true
+	return c
+}
@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// 46. EVENTS
+// ---------------------------------------------------------
+
+// Event is one line of the stream StreamEvents turns on: a run entering
+// a phase ("load", "write", "third_party", ...), a file written into the
+// output, a warning, or, sent by the caller, the run's error.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"` // phase, file, warning, error, done
+	Phase   string    `json:"phase,omitempty"`
+	File    string    `json:"file,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+var (
+	eventsMu sync.Mutex
+	events   func(Event)
+
+	progressMu sync.Mutex
+	progressTo io.Writer = os.Stdout
+)
+
+// StreamEvents writes every Event of the runs that follow to w as
+// newline-delimited JSON, for orchestration to follow a run as it goes.
+// The human-readable progress is printed as before; callers streaming to
+// stdout send it elsewhere with SetProgress.
+func StreamEvents(w io.Writer) {
+	enc := json.NewEncoder(w)
+	HandleEvents(func(e Event) { enc.Encode(e) })
+}
+
+// HandleEvents passes every Event of the runs that follow to f (none for
+// a nil f) and returns the handler it replaces.
+func HandleEvents(f func(Event)) func(Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	prev := events
+	events = f
+	return prev
+}
+
+// SetProgress prints the human-readable progress of the runs that
+// follow to w (os.Stdout until set, nothing for a nil w) and returns the
+// writer it replaces.
+func SetProgress(w io.Writer) io.Writer {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	prev := progressTo
+	if w == nil {
+		w = io.Discard
+	}
+	progressTo = w
+	return prev
+}
+
+// progress is the writer the human-readable progress goes to.
+func progress() io.Writer {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	return progressTo
+}
+
+// SendEvent hands e to the handler, if there is one, stamping its time.
+func SendEvent(e Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if events == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	events(e)
+}
+
+// phase marks the run entering the named phase.
+func phase(name string) {
+	SendEvent(Event{Type: "phase", Phase: name})
+}
+
+// warnf prints a warning and sends it as an event.
+func warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Fprintf(progress(), "⚠️  %s\n", msg)
+	SendEvent(Event{Type: "warning", Message: msg})
+}
@@ -0,0 +1,82 @@
+package lib
+
+import (
+	"sort"
+	"strings"
+)
+
+// 13. FLAT LAYOUT
+// ---------------------------------------------------------
+
+// planLayout decides where each module lives under third_party. By
+// default that is its full module path; with FlatThirdParty the leading
+// host element is dropped, except for modules whose packages would then
+// collide with another module's, which keep their host.
+func (g *Generator) planLayout(mods, pkgs []string, owner map[string]string) {
+	g.layout = map[string]string{}
+	for _, mod := range mods {
+		g.layout[mod] = mod
+	}
+	if !g.FlatThirdParty {
+		return
+	}
+
+	sorted := append([]string{}, mods...)
+	sort.Strings(sorted)
+	taken := map[string]string{} // shaded package path -> module
+	for _, pkg := range pkgs {
+		taken[pkg] = owner[pkg]
+	}
+	for _, mod := range sorted {
+		flat := stripHost(mod)
+		if flat == mod {
+			continue
+		}
+		collides := false
+		for _, pkg := range pkgs {
+			if owner[pkg] != mod {
+				continue
+			}
+			if other, ok := taken[flat+strings.TrimPrefix(pkg, mod)]; ok && other != mod {
+				collides = true
+				break
+			}
+		}
+		if collides {
+			warnf("Keeping %s under its host: %s is taken", mod, flat)
+			continue
+		}
+		g.layout[mod] = flat
+		for _, pkg := range pkgs {
+			if owner[pkg] == mod {
+				delete(taken, pkg)
+				taken[flat+strings.TrimPrefix(pkg, mod)] = mod
+			}
+		}
+	}
+}
+
+// stripHost drops a leading element that looks like a host name, so
+// "github.com/pkg/errors" becomes "pkg/errors".
+func stripHost(mod string) string {
+	host, rest, ok := strings.Cut(mod, "/")
+	if !ok || !strings.Contains(host, ".") {
+		return mod
+	}
+	return rest
+}
+
+// shadedPath maps a slash-separated path inside a vendored module (a
+// package, or a file) to where it lives under third_party.
+func (g *Generator) shadedPath(p string) string {
+	best := ""
+	for mod := range g.layout {
+		if hasPathPrefix(p, mod) && len(mod) > len(best) {
+			best = mod
+		}
+	}
+	if best == "" {
+		return p
+	}
+	return g.layout[best] + strings.TrimPrefix(p, best)
+}
@@ -0,0 +1,101 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/txtar"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// TestGolden splits the files of each testdata/golden archive in memory
+// and compares the Go files written against the archive's want/ files.
+// Comments, directives and struct tags must come out where they were.
+// An "options:" line in the archive's comment holds the run's Options
+// as JSON.
+func TestGolden(t *testing.T) {
+	archives, err := filepath.Glob("testdata/golden/*.txtar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range archives {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".txtar"), func(t *testing.T) {
+			ar, err := txtar.ParseFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			src := Source{Path: "example.com/p", Files: map[string][]byte{}}
+			want := map[string][]byte{}
+			for _, f := range ar.Files {
+				if name, ok := strings.CutPrefix(f.Name, "want/"); ok {
+					want[name] = f.Data
+				} else {
+					src.Files[f.Name] = f.Data
+				}
+			}
+			var opts Options
+			for _, line := range strings.Split(string(ar.Comment), "\n") {
+				if js, ok := strings.CutPrefix(line, "options: "); ok {
+					if err := json.Unmarshal([]byte(js), &opts); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			out, err := GenerateInMemory(src, nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string][]byte{}
+			for name, data := range out {
+				if strings.HasSuffix(name, ".go") {
+					got[name] = data
+				}
+			}
+
+			if *update {
+				ar.Files = slices.DeleteFunc(ar.Files, func(f txtar.File) bool { return strings.HasPrefix(f.Name, "want/") })
+				for _, name := range slices.Sorted(maps.Keys(got)) {
+					ar.Files = append(ar.Files, txtar.File{Name: "want/" + name, Data: got[name]})
+				}
+				if err := os.WriteFile(file, txtar.Format(ar), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			for name, data := range got {
+				if w, ok := want[name]; !ok {
+					t.Errorf("unexpected %s:\n%s", name, data)
+				} else if !bytes.Equal(data, w) {
+					t.Errorf("%s:\n%s\nwant:\n%s", name, data, w)
+				}
+			}
+			for name := range want {
+				if _, ok := got[name]; !ok {
+					t.Errorf("%s not written", name)
+				}
+			}
+		})
+	}
+}
+
+// TestDuplicateFileNames makes sure a file kept intact and a bucket that
+// come out under one name fail the run rather than overwrite each other.
+func TestDuplicateFileNames(t *testing.T) {
+	src := Source{Path: "example.com/p", Files: map[string][]byte{
+		"go.mod":     []byte("module example.com/p\n\ngo 1.22\n"),
+		"p.go":       []byte("package p\n\nfunc F() {}\n"),
+		"p_funcs.go": []byte("package p\n\nimport _ \"unsafe\"\n\n//go:linkname now runtime.nanotime\nfunc now() int64\n"),
+	}}
+	_, err := GenerateInMemory(src, nil, Options{})
+	if err == nil || !strings.Contains(err.Error(), "p_funcs.go: two generated files get this name") {
+		t.Fatalf("GenerateInMemory: %v, want p_funcs.go reported twice", err)
+	}
+}
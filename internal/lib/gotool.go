@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// 47. GO TOOL
+// ---------------------------------------------------------
+
+// toolComment starts the comment on a go.mod tool directive that holds
+// the flags `go tool bradley` runs with:
+//
+//	tool github.com/immanuel-254/bradley // bradley: -index -files 4
+const toolComment = "bradley:"
+
+// GoToolArgs gives the arguments to run with when bradley was started
+// without any, as `go tool bradley` from inside a module whose go.mod
+// declares it with a tool directive (Go 1.24). They are the flags of the
+// directive's bradley: comment, then -config with the module's
+// bradley.json if there is one, then the module root as the input unless
+// that config names one. It returns nil outside such a module.
+func GoToolArgs(dir string) ([]string, error) {
+	root, _, err := enclosingModule(dir)
+	if err != nil {
+		return nil, nil
+	}
+	mf, tool, err := selfTool(root)
+	if mf == nil || tool == nil {
+		return nil, err
+	}
+
+	var args []string
+	if tool.Syntax != nil {
+		for _, c := range tool.Syntax.Suffix {
+			text := strings.TrimSpace(strings.TrimPrefix(c.Token, "//"))
+			if flags, ok := strings.CutPrefix(text, toolComment); ok {
+				args = append(args, strings.Fields(flags)...)
+			}
+		}
+	}
+	hasInput := false
+	if file := filepath.Join(root, ConfigFile); exists(file) {
+		args = append(args, "-config", file)
+		if cfg, err := LoadConfig(file); err == nil && cfg.Input != "" {
+			hasInput = true
+		}
+	}
+	if !hasInput {
+		args = append(args, root)
+	}
+	return args, nil
+}
+
+// selfPath is the import path of the running binary's main package, as
+// a tool directive would name it.
+func selfPath() string {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		return bi.Path
+	}
+	return ""
+}
+
+// selfTool parses the go.mod of the module at root and finds the tool
+// directive naming the running binary, if any.
+func selfTool(root string) (*modfile.File, *modfile.Tool, error) {
+	self := selfPath()
+	if self == "" {
+		return nil, nil, nil
+	}
+	file := filepath.Join(root, "go.mod")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	mf, err := modfile.Parse(file, data, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, t := range mf.Tool {
+		if t.Path == self {
+			return mf, t, nil
+		}
+	}
+	return mf, nil, nil
+}
+
+// vendorModfile writes, into dir, a copy of the input module's go.mod
+// (and go.sum) without the tool directive declaring bradley itself, so
+// go mod vendor leaves bradley and what only it needs out of
+// third_party. It returns g.modFile, or "", when there is no such
+// directive.
+func (g *Generator) vendorModfile(dir string) (string, error) {
+	mf, tool, err := selfTool(g.requirementsDir())
+	if mf == nil || tool == nil {
+		return g.modFile, err
+	}
+	if err := mf.DropTool(tool.Path); err != nil {
+		return "", err
+	}
+	mf.Cleanup()
+	data, err := mf.Format()
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, "go.mod")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return "", err
+	}
+	if sum, err := os.ReadFile(filepath.Join(g.requirementsDir(), "go.sum")); err == nil {
+		if err := os.WriteFile(filepath.Join(dir, "go.sum"), sum, 0644); err != nil {
+			return "", err
+		}
+	}
+	return file, nil
+}
+
+// scratchModfile copies the go.mod and go.sum of the module at root into
+// dir and returns the go.mod copy, for go commands run in root with
+// -modfile: whatever they add or upgrade lands in the copy, never in the
+// user's module.
+func scratchModfile(root, dir string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, "go.mod")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		return "", err
+	}
+	if sum, err := os.ReadFile(filepath.Join(root, "go.sum")); err == nil {
+		if err := os.WriteFile(filepath.Join(dir, "go.sum"), sum, 0644); err != nil {
+			return "", err
+		}
+	}
+	return file, nil
+}
+
+// requirementsDir holds the go.mod listing the input's dependencies:
+// g.modFile's directory when set, the input's module otherwise.
+func (g *Generator) requirementsDir() string {
+	if g.modFile != "" {
+		return filepath.Dir(g.modFile)
+	}
+	return g.moduleDir
+}
+
+// scratchModFlag copies the go.mod listing the input's dependencies
+// into a temporary directory, for a go command that may write to it
+// (-mod=mod), and returns the -modfile flag pointing there with the func
+// removing the copy.
+func (g *Generator) scratchModFlag() (string, func(), error) {
+	dir, err := os.MkdirTemp("", "bradley-modfile-")
+	if err != nil {
+		return "", nil, err
+	}
+	file, err := scratchModfile(g.requirementsDir(), dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	return "-modfile=" + file, func() { os.RemoveAll(dir) }, nil
+}
+
+// modFlags points a go command at g.modFile, if set.
+func (g *Generator) modFlags() []string {
+	if g.modFile == "" {
+		return nil
+	}
+	return []string{"-modfile=" + g.modFile}
+}
+
+// exists reports whether file exists.
+func exists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
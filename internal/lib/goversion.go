@@ -0,0 +1,81 @@
+package lib
+
+import (
+	"fmt"
+	"go/version"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// 30. GO VERSION REQUIREMENTS
+// ---------------------------------------------------------
+
+// goAnnotation returns the go version in a modules.txt "## explicit; go
+// 1.22" line, or "".
+func goAnnotation(line string) string {
+	for _, field := range strings.Split(strings.TrimPrefix(line, "##"), ";") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(field), "go "); ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// inputGoVersion reads the go directive of the go.mod in dir, "" when
+// there is none.
+func inputGoVersion(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	mf, err := modfile.ParseLax("go.mod", data, nil)
+	if err != nil || mf.Go == nil {
+		return ""
+	}
+	return mf.Go.Version
+}
+
+// targetGoVersion is the language version shaded code is compiled at
+// once it is part of the output module: the input module's go directive,
+// which the output's go.mod carries over. Only for an input outside any
+// module does it fall back to the go directive go mod init wrote.
+func (g *Generator) targetGoVersion() string {
+	if g.goVersion != "" || g.memory != nil {
+		return g.goVersion
+	}
+	return inputGoVersion(g.OutputDir)
+}
+
+// checkGoVersions fails before anything is shaded when a module's go
+// directive (required maps module to version) is newer than the output
+// targets, which would otherwise surface as compile errors about
+// language features deep inside third_party.
+func (g *Generator) checkGoVersions(required map[string]string) error {
+	target := g.targetGoVersion()
+	if target == "" {
+		return nil
+	}
+	var newer []string
+	need := target
+	for mod, v := range required {
+		if version.Compare("go"+v, "go"+target) > 0 {
+			newer = append(newer, fmt.Sprintf("%s needs go %s", mod, v))
+			if version.Compare("go"+v, "go"+need) > 0 {
+				need = v
+			}
+		}
+	}
+	if len(newer) == 0 {
+		return nil
+	}
+	sort.Strings(newer)
+	return fmt.Errorf("shaded modules need a newer Go than the input module's go %s:\n%s\nraise the input module's go directive (go mod edit -go=%s) or require older versions of these modules",
+		target, indent(strings.Join(newer, "\n")), need)
+}
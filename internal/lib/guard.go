@@ -0,0 +1,136 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 43. SOURCE GUARD
+// ---------------------------------------------------------
+
+// fileStamp is what snapshotModule remembers of a file.
+type fileStamp struct {
+	size int64
+	mode fs.FileMode
+	mod  time.Time
+}
+
+// guardedDir is a directory snapshotModule records: the files in it,
+// and with deep those of its subdirectories too.
+type guardedDir struct {
+	dir  string
+	deep bool
+}
+
+// snapshotModule records the files of g.guarded, leaving out what the
+// run itself writes there (a sibling output in the module root, a nested
+// one, its zip, run lock and backup, a shared third_party) and .git.
+func (g *Generator) snapshotModule() (map[string]fileStamp, error) {
+	var own []string
+	for _, p := range []string{g.OutputDir, g.ThirdPartyDir, g.zipPath(), g.runLockPath(), backupPath(g.OutputDir), backupPath(g.ThirdPartyDir)} {
+		if abs, err := filepath.Abs(p); err == nil {
+			own = append(own, abs)
+		}
+	}
+	stamps := map[string]fileStamp{}
+	for _, guarded := range g.guarded {
+		err := filepath.WalkDir(guarded.dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if p == guarded.dir && errors.Is(err, fs.ErrNotExist) {
+					return nil // No testdata
+				}
+				return err
+			}
+			for _, o := range own {
+				if p == o || strings.HasPrefix(p, o+string(filepath.Separator)) {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+			}
+			if d.IsDir() {
+				if p != guarded.dir && (!guarded.deep || d.Name() == ".git") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			stamps[p] = fileStamp{info.Size(), info.Mode(), info.ModTime()}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stamps, nil
+}
+
+// checkUntouched reports a file of the input's module created, changed
+// or deleted since g.snapshot was taken: bradley only ever reads the
+// module it splits. It runs as the output is released, so failed and
+// interrupted runs are checked as well.
+func (g *Generator) checkUntouched() error {
+	if g.snapshot == nil {
+		return nil
+	}
+	now, err := g.snapshotModule()
+	if err != nil {
+		return err
+	}
+	var changed []string
+	for p, stamp := range now {
+		before, ok := g.snapshot[p]
+		switch {
+		case !ok:
+			changed = append(changed, "created "+p)
+		case before.size != stamp.size || before.mode != stamp.mode || !before.mod.Equal(stamp.mod):
+			changed = append(changed, "modified "+p)
+		}
+	}
+	for p := range g.snapshot {
+		if _, ok := now[p]; !ok {
+			changed = append(changed, "deleted "+p)
+		}
+	}
+	if len(changed) > 0 {
+		slices.Sort(changed)
+		return fmt.Errorf("the run changed the input module, which it must only read:\n%s", indent(strings.Join(changed, "\n")))
+	}
+	return nil
+}
+
+// guardModule finds the inputs' module and snapshots what a run could
+// touch there for checkUntouched: the files at the module root (go.mod,
+// go.sum, go.work), those of each input package and its testdata. The
+// rest of the module, however large, is not walked. Inputs outside any
+// module go unguarded.
+func (g *Generator) guardModule(inputs ...string) error {
+	root, _, err := enclosingModule(inputs[0])
+	if err != nil {
+		return nil
+	}
+	g.moduleDir = root
+	g.guarded = []guardedDir{{dir: root}}
+	for _, input := range inputs {
+		dir, err := filepath.Abs(input)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+		g.guarded = append(g.guarded, guardedDir{dir: dir}, guardedDir{dir: filepath.Join(dir, "testdata"), deep: true})
+	}
+	g.snapshot, err = g.snapshotModule()
+	return err
+}
@@ -0,0 +1,184 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/zip"
+)
+
+// TestGenerateLeavesInputUntouched generates, then updates, against a
+// copy of a module in a temporary directory and checks that nothing but
+// the output changed there, nor in the working directory the test
+// started in.
+func TestGenerateLeavesInputUntouched(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := t.TempDir()
+	mod := filepath.Join(tmp, "mylib")
+	writeTree(t, mod, map[string]string{
+		"go.mod":               "module example.com/mylib\n\ngo 1.22\n\nrequire example.com/dep v1.0.0\n",
+		"mylib.go":             "// Package mylib is split.\npackage mylib\n\nimport (\n\t\"strings\"\n\n\t\"example.com/dep\"\n)\n\ntype T struct{ S string }\n\nfunc (t T) Upper() string { return strings.ToUpper(t.S) + dep.Suffix }\n\nfunc New(s string) T { return T{s} }\n",
+		"mylib_test.go":        "package mylib\n\nimport \"testing\"\n\nfunc TestNew(t *testing.T) { New(\"x\") }\n",
+		"testdata/fixture.txt": "kept\n",
+		"sub/sub.go":           "package sub\n",
+	})
+	// A proxy serving two versions of the dependency, so update upgrades
+	proxy := filepath.Join(t.TempDir(), "proxy")
+	for _, v := range []string{"v1.0.0", "v1.1.0"} {
+		writeProxyModule(t, proxy, "example.com/dep", v, map[string]string{
+			"go.mod": "module example.com/dep\n\ngo 1.22\n",
+			"dep.go": "package dep\n\nconst Suffix = \"" + v + "\"\n",
+		})
+	}
+	t.Setenv("GOPROXY", "file://"+filepath.ToSlash(proxy))
+	t.Setenv("GOSUMDB", "off")
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOMODCACHE", t.TempDir())
+	if out, err := exec.Command("go", "-C", mod, "mod", "tidy").CombinedOutput(); err != nil {
+		t.Fatalf("go mod tidy: %v\n%s", err, out)
+	}
+	t.Chdir(tmp)
+
+	beforeTmp, beforeWd := treeSums(t, tmp), treeSums(t, wd)
+	dir, _, err := Generate([]string{mod}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := filepath.Abs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(out, "go.mod")); err != nil {
+		t.Fatalf("no output module: %v", err)
+	}
+	check := func(run string) {
+		t.Helper()
+		afterTmp := treeSums(t, tmp)
+		maps.DeleteFunc(afterTmp, func(p, _ string) bool {
+			return strings.HasPrefix(p, out+string(filepath.Separator))
+		})
+		if !maps.Equal(beforeTmp, afterTmp) {
+			t.Errorf("%s changed the temporary module:\nbefore %v\nafter  %v", run, beforeTmp, afterTmp)
+		}
+		if !maps.Equal(beforeWd, treeSums(t, wd)) {
+			t.Errorf("%s changed %s", run, wd)
+		}
+	}
+	check("generate")
+
+	if err := UpdateFiles(mod, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	check("update")
+	if data, err := os.ReadFile(filepath.Join(out, LockFile)); err != nil || !strings.Contains(string(data), "v1.1.0") {
+		t.Errorf("update did not upgrade the output to example.com/dep v1.1.0:\n%s", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(out, "third_party", "example.com", "dep", "dep.go")); !strings.Contains(string(data), "v1.1.0") {
+		t.Errorf("update kept the previous copy of example.com/dep:\n%s", data)
+	}
+}
+
+// writeProxyModule adds version of the module at path, made of files,
+// to the file-based module proxy at proxy.
+func writeProxyModule(t *testing.T, proxy, path, version string, files map[string]string) {
+	t.Helper()
+	src := t.TempDir()
+	writeTree(t, src, files)
+	dir := filepath.Join(proxy, filepath.FromSlash(path), "@v")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, version+".zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := zip.CreateFromDir(f, module.Version{Path: path, Version: version}, src); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := os.ReadFile(filepath.Join(dir, "list"))
+	writeTree(t, dir, map[string]string{
+		version + ".mod":  files["go.mod"],
+		version + ".info": `{"Version":"` + version + `"}`,
+		"list":            string(list) + version + "\n",
+	})
+}
+
+// TestCheckUntouched makes sure changes within the guarded directories
+// are reported, and changes elsewhere in the module are not looked at.
+func TestCheckUntouched(t *testing.T) {
+	mod := t.TempDir()
+	writeTree(t, mod, map[string]string{
+		"go.mod":              "module example.com/m\n\ngo 1.22\n",
+		"p/p.go":              "package p\n",
+		"p/testdata/a/b.txt":  "b\n",
+		"other/deep/other.go": "package deep\n",
+	})
+	g := &Generator{OutputDir: filepath.Join(mod, "p_split")}
+	if err := g.guardModule(filepath.Join(mod, "p")); err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, mod, map[string]string{
+		"other/deep/other.go": "package deep // not guarded\n",
+		"p_split/go.mod":      "module p_split\n",
+	})
+	if err := g.checkUntouched(); err != nil {
+		t.Fatalf("checkUntouched: %v, want nil", err)
+	}
+
+	writeTree(t, mod, map[string]string{"go.sum": "", "p/testdata/a/b.txt": "changed\n"})
+	err := g.checkUntouched()
+	if err == nil {
+		t.Fatal("checkUntouched: nil, want the changes")
+	}
+	for _, want := range []string{"created " + filepath.Join(mod, "go.sum"), "modified " + filepath.Join(mod, "p/testdata/a/b.txt")} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("checkUntouched: %v, want it to mention %q", err, want)
+		}
+	}
+}
+
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// treeSums maps each file beneath dir to a hash of its contents.
+func treeSums(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	sums := map[string]string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		sums[p] = string(sum[:])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sums
+}
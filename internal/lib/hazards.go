@@ -0,0 +1,99 @@
+package lib
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"path/filepath"
+	"strings"
+)
+
+// 7. SPLIT HAZARDS
+// ---------------------------------------------------------
+
+// splitHazards lists the reasons a file's declarations depend on sharing
+// that file: a cgo preamble, //go:linkname directives (which need their
+// unsafe import alongside), compiler directives not attached to any
+// declaration, and //line directives remapping positions.
+func splitHazards(file *ast.File) []string {
+	var reasons []string
+	for _, imp := range file.Imports {
+		if imp.Path.Value == `"C"` {
+			reasons = append(reasons, "cgo preamble")
+			break
+		}
+	}
+
+	attached := map[*ast.CommentGroup]bool{}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			attached[d.Doc] = true
+		case *ast.GenDecl:
+			attached[d.Doc] = true
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.ValueSpec:
+					attached[s.Doc] = true
+				case *ast.TypeSpec:
+					attached[s.Doc] = true
+				}
+			}
+		}
+	}
+
+	var linkname, detached, line bool
+	for _, group := range file.Comments {
+		if group.Pos() < file.Package {
+			continue // Build constraints and banners are handled as headers
+		}
+		for _, c := range group.List {
+			switch {
+			case strings.HasPrefix(c.Text, "//go:linkname "):
+				linkname = true
+			case strings.HasPrefix(c.Text, "//line ") || strings.HasPrefix(c.Text, "/*line "):
+				line = true
+			case strings.HasPrefix(c.Text, "//go:") && !attached[group]:
+				detached = true
+			}
+		}
+	}
+	if linkname {
+		reasons = append(reasons, "//go:linkname")
+	}
+	if detached {
+		reasons = append(reasons, "detached //go: directive")
+	}
+	if line {
+		reasons = append(reasons, "//line directive")
+	}
+	return reasons
+}
+
+// pinFiles writes files with split hazards out whole, under their own
+// names and with only the package clause changed, and returns the rest.
+func (g *Generator) pinFiles(files []*ast.File) ([]*ast.File, error) {
+	var free []*ast.File
+	for _, file := range files {
+		reasons := splitHazards(file)
+		if len(reasons) == 0 {
+			free = append(free, file)
+			continue
+		}
+		name := filepath.Base(g.Fset.File(file.Pos()).Name())
+		warnf("Keeping %s intact (%s)", name, strings.Join(reasons, ", "))
+
+		if err := g.claim(name); err != nil {
+			return nil, err
+		}
+		file.Name.Name = g.PackageName
+		var buf bytes.Buffer
+		if err := format.Node(&buf, g.Fset, file); err != nil {
+			return nil, err
+		}
+		if err := g.emit(name, buf.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	return free, nil
+}
@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// 42. SYMBOL INDEX
+// ---------------------------------------------------------
+
+// IndexFile is the symbol index Options.Index writes into OutputDir.
+const IndexFile = "INDEX.md"
+
+type indexEntry struct {
+	pkg, symbol, kind, file string
+}
+
+// writeIndex lists every exported symbol of the output, third_party and
+// tests aside, with the package and generated file declaring it, so a
+// large split stays navigable.
+func (g *Generator) writeIndex() error {
+	sources, err := g.outputSources()
+	if err != nil {
+		return err
+	}
+	var entries []indexEntry
+	fset := token.NewFileSet()
+	for _, name := range slices.Sorted(maps.Keys(sources)) {
+		file, err := parser.ParseFile(fset, name, sources[name], parser.SkipObjectResolution)
+		if err != nil {
+			return fmt.Errorf("index: %w", err)
+		}
+		pkg := g.ProjectName
+		if dir := path.Dir(name); dir != "." {
+			pkg = importPath(g.ProjectName, dir)
+		}
+		add := func(symbol, kind string) {
+			entries = append(entries, indexEntry{pkg, symbol, kind, name})
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				switch {
+				case d.Recv == nil && d.Name.IsExported():
+					add(d.Name.Name, "func")
+				case d.Recv != nil && d.Name.IsExported() && ast.IsExported(receiverName(d)):
+					add(receiverName(d)+"."+d.Name.Name, "method")
+				}
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch s := spec.(type) {
+					case *ast.TypeSpec:
+						if s.Name.IsExported() {
+							add(s.Name.Name, "type")
+						}
+					case *ast.ValueSpec:
+						for _, id := range s.Names {
+							if id.IsExported() {
+								add(id.Name, d.Tok.String())
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].pkg != entries[j].pkg {
+			return entries[i].pkg < entries[j].pkg
+		}
+		return entries[i].symbol < entries[j].symbol
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Index of %s\n", g.ProjectName)
+	for i, e := range entries {
+		if i == 0 || e.pkg != entries[i-1].pkg {
+			fmt.Fprintf(&b, "\n## %s\n\n| Symbol | Kind | File |\n| --- | --- | --- |\n", e.pkg)
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | [%s](%s) |\n", e.symbol, e.kind, e.file, e.file)
+	}
+	fmt.Fprintf(progress(), "🗂️  Indexed %d exported symbols in %s\n", len(entries), IndexFile)
+	return g.emit(IndexFile, []byte(b.String()))
+}
+
+// outputSources returns the non-test Go files of the output module,
+// named relative to OutputDir, leaving out third_party and any
+// directory the go command ignores.
+func (g *Generator) outputSources() (map[string][]byte, error) {
+	sources := map[string][]byte{}
+	keep := func(name string) bool {
+		return strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") && !hasPathPrefix(name, "third_party")
+	}
+	if g.memory != nil {
+		for name, data := range g.memory {
+			if keep(name) {
+				sources[name] = data
+			}
+		}
+		return sources, nil
+	}
+	err := filepath.WalkDir(g.OutputDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(g.OutputDir, p)
+		if err != nil {
+			return err
+		}
+		name := slashPath(rel)
+		if d.IsDir() {
+			base := d.Name()
+			if name != "." && (name == "third_party" || base == "testdata" || strings.HasPrefix(base, ".") || strings.HasPrefix(base, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if keep(name) {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			sources[name] = data
+		}
+		return nil
+	})
+	return sources, err
+}
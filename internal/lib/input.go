@@ -0,0 +1,453 @@
+package lib
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// 0. INPUT LOADING
+// ---------------------------------------------------------
+
+// inputPackage is the package being split, grouped the way the go tool
+// would compile it. A single-file input only ever fills Files.
+type inputPackage struct {
+	Name          string
+	ImportPath    string      // original import path, when known
+	Files         []*ast.File // package Name
+	Tests         []*ast.File // package Name, from _test.go files
+	ExternalTests []*ast.File // package Name_test
+}
+
+// Dependencies are type-checked from source (NeedDeps) rather than from
+// export data, which ties the loader less tightly to the toolchain.
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles |
+	packages.NeedImports | packages.NeedDeps | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo
+
+// loadInput loads the input through go/packages so later phases have
+// type information. Files excluded from the current build by their
+// constraints are still parsed, syntax only, so every variant is split.
+// When the package cannot be loaded (no module, cgo, a broken toolchain)
+// it falls back to parsing alone.
+func (g *Generator) loadInput(input string) (*inputPackage, error) {
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkInput(input); err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(input)
+	if err != nil {
+		return nil, err
+	}
+	dir, pattern := abs, "."
+	if !info.IsDir() {
+		dir, pattern = filepath.Dir(abs), "file="+abs
+	}
+
+	cfg := &packages.Config{Context: runContext(), Mode: loadMode, Dir: dir, Fset: g.Fset, Tests: info.IsDir(), BuildFlags: g.modFlags()}
+	pkgs, err := packages.Load(cfg, pattern)
+	if err != nil {
+		warnf("Type information unavailable (%v); splitting on syntax alone", err)
+		return g.parseInput(input)
+	}
+
+	var base, external *packages.Package
+	for _, p := range pkgs {
+		switch {
+		case strings.HasSuffix(p.ID, ".test"):
+			// Synthesized test main
+		case strings.HasSuffix(p.Name, "_test"):
+			external = p
+		case base == nil || strings.Contains(p.ID, " ["):
+			base = p // Prefer the variant compiled with the _test.go files
+		}
+	}
+	if base == nil || len(base.Syntax) == 0 || len(base.CompiledGoFiles) != len(base.GoFiles) {
+		// Cgo rewrites CompiledGoFiles; split the sources the user wrote
+		return g.parseInput(input)
+	}
+	for _, e := range base.Errors {
+		if e.Kind != packages.TypeError {
+			warnf("%v; splitting on syntax alone", e)
+			return g.parseInput(input)
+		}
+		warnf("%v", e)
+	}
+
+	pkg := &inputPackage{Name: base.Name, ImportPath: base.PkgPath}
+	for i, file := range base.Syntax {
+		path := base.CompiledGoFiles[i]
+		if !info.IsDir() && path != abs {
+			continue
+		}
+		g.trackComments(file)
+		g.trackTypes(file, base.TypesInfo, base.Types)
+		pkg.add(path, file)
+	}
+	if external != nil {
+		for i, file := range external.Syntax {
+			g.trackComments(file)
+			g.trackTypes(file, external.TypesInfo, external.Types)
+			pkg.add(external.CompiledGoFiles[i], file)
+		}
+	}
+	if info.IsDir() {
+		for _, path := range base.IgnoredFiles {
+			if !strings.HasSuffix(path, ".go") {
+				continue
+			}
+			file, err := parser.ParseFile(g.Fset, path, nil, parser.ParseComments)
+			if err != nil {
+				return nil, err
+			}
+			g.trackComments(file)
+			pkg.add(path, file)
+		}
+	}
+	if len(pkg.Files) == 0 {
+		return nil, fmt.Errorf("%s: no buildable files for package %s", input, pkg.Name)
+	}
+	return pkg, nil
+}
+
+// parseInput is the syntax-only loader.
+func (g *Generator) parseInput(input string) (*inputPackage, error) {
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		file, err := parser.ParseFile(g.Fset, input, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		g.trackComments(file)
+		return &inputPackage{Name: file.Name.Name, Files: []*ast.File{file}}, nil
+	}
+
+	name, err := primaryPackage(input)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &inputPackage{Name: name}
+	if out, err := cmdOutput(input, "go", "list", "-f", "{{.ImportPath}}", "."); err == nil {
+		pkg.ImportPath = out
+	}
+
+	for _, path := range goFiles(input) {
+		file, err := parser.ParseFile(g.Fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		g.trackComments(file)
+		pkg.add(path, file)
+	}
+	if len(pkg.Files) == 0 {
+		return nil, fmt.Errorf("%s: no buildable files for package %s", input, name)
+	}
+	return pkg, nil
+}
+
+// add files a parsed source under the group the go tool would compile
+// it in, skipping files that belong to no group.
+func (pkg *inputPackage) add(path string, file *ast.File) {
+	name := pkg.Name
+	isTest := strings.HasSuffix(path, "_test.go")
+	switch {
+	case isIgnored(file):
+		fmt.Fprintf(progress(), "⏭️  Skipping %s (ignored by build constraint)\n", filepath.Base(path))
+	case file.Name.Name == name && isTest:
+		pkg.Tests = append(pkg.Tests, file)
+	case file.Name.Name == name:
+		pkg.Files = append(pkg.Files, file)
+	case file.Name.Name == name+"_test" && isTest:
+		pkg.ExternalTests = append(pkg.ExternalTests, file)
+	default:
+		fmt.Fprintf(progress(), "⏭️  Skipping %s (package %s, expected %s)\n", filepath.Base(path), file.Name.Name, name)
+	}
+}
+
+// primaryPackage reports the package clause of a file, or for a directory
+// the package most of its non-test, non-ignored files declare.
+func primaryPackage(input string) (string, error) {
+	info, err := os.Stat(input)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		node, err := parser.ParseFile(token.NewFileSet(), input, nil, parser.PackageClauseOnly)
+		if err != nil {
+			return "", err
+		}
+		return node.Name.Name, nil
+	}
+
+	counts := map[string]int{}
+	for _, path := range goFiles(input) {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		node, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil {
+			return "", err
+		}
+		if !isIgnored(node) {
+			counts[node.Name.Name]++
+		}
+	}
+	best := ""
+	for name, n := range counts {
+		if n > counts[best] || (n == counts[best] && name < best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("%s: no Go package found", input)
+	}
+	return best, nil
+}
+
+// goFiles lists the .go files the go tool would consider in dir.
+func goFiles(dir string) []string {
+	entries, _ := os.ReadDir(dir)
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	sort.Strings(files)
+	return files
+}
+
+// isIgnored reports whether a file is excluded via the "ignore" build tag
+// convention used for generators and scratch programs.
+func isIgnored(file *ast.File) bool {
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, c := range group.List {
+			if !constraint.IsGoBuild(c.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err != nil {
+				continue
+			}
+			if !satisfiable(expr, "ignore") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// satisfiable reports whether some assignment of tags, with tag off,
+// satisfies expr.
+func satisfiable(expr constraint.Expr, off string) bool {
+	var tags []string
+	seen := map[string]bool{off: true}
+	for _, tag := range constraintTags(expr) {
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 16 {
+		return true // Too many to enumerate; assume the file is buildable
+	}
+	for mask := 0; mask < 1<<len(tags); mask++ {
+		ok := expr.Eval(func(tag string) bool {
+			for i, t := range tags {
+				if t == tag {
+					return mask&(1<<i) != 0
+				}
+			}
+			return false
+		})
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func constraintTags(expr constraint.Expr) []string {
+	switch x := expr.(type) {
+	case *constraint.TagExpr:
+		return []string{x.Tag}
+	case *constraint.NotExpr:
+		return constraintTags(x.X)
+	case *constraint.AndExpr:
+		return append(constraintTags(x.X), constraintTags(x.Y)...)
+	case *constraint.OrExpr:
+		return append(constraintTags(x.X), constraintTags(x.Y)...)
+	}
+	return nil
+}
+
+// fileHeader splits the comments above a file's package clause into its
+// banner (copyright notices and the like, minus the package doc) and its
+// build constraint line, if any.
+func fileHeader(file *ast.File) (banner []string, buildLine string) {
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		if group == file.Doc {
+			continue
+		}
+		var lines []string
+		for _, c := range group.List {
+			switch {
+			case constraint.IsGoBuild(c.Text):
+				buildLine = c.Text
+			case constraint.IsPlusBuild(c.Text):
+				// Superseded by the //go:build line gofmt keeps in sync
+			default:
+				lines = append(lines, c.Text)
+			}
+		}
+		if len(lines) > 0 {
+			banner = append(banner, strings.Join(lines, "\n"))
+		}
+	}
+	return banner, buildLine
+}
+
+// packageBanner picks the banner generated files carry: the first one
+// found among files.
+func packageBanner(files []*ast.File) string {
+	for _, file := range files {
+		if banner, _ := fileHeader(file); banner != nil {
+			return strings.Join(banner, "\n\n")
+		}
+	}
+	return ""
+}
+
+// variant is the slice of a package compiled under one build constraint.
+type variant struct {
+	label     string // distinguishes the variant's bucket names; "" for common files
+	suffix    string // GOOS/GOARCH filename suffix shared by all its files
+	buildLine string
+	files     []*ast.File
+	tests     []*ast.File
+	xtests    []*ast.File // external tests, package x_test
+}
+
+// base extends the base name of buckets with the variant's label, unless
+// its filename suffix already tells it apart.
+func (v *variant) base(base string) string {
+	if v.label != "" && v.label != v.suffix {
+		return base + "_" + v.label
+	}
+	return base
+}
+
+// variants partitions a package by effective build constraint: the
+// file's //go:build line combined with its filename suffix. Platform
+// variants of the same declarations (foo_linux.go, foo_windows.go) thus
+// never share a bucket. When every file agrees there is a single
+// unlabeled variant carrying that constraint.
+func (g *Generator) variants(pkg *inputPackage) []*variant {
+	var order []string
+	groups := map[string]*variant{}
+	add := func(file *ast.File, list func(*variant) *[]*ast.File) {
+		_, suffix := platformSuffix(filepath.Base(g.Fset.File(file.Pos()).Name()))
+		key := effectiveConstraint(file, suffix)
+		v, ok := groups[key]
+		if !ok {
+			v = &variant{suffix: suffix}
+			if key != "" {
+				v.buildLine = "//go:build " + key
+			}
+			groups[key] = v
+			order = append(order, key)
+		}
+		if v.suffix != suffix {
+			v.suffix = ""
+		}
+		*list(v) = append(*list(v), file)
+	}
+	for _, file := range pkg.Files {
+		add(file, func(v *variant) *[]*ast.File { return &v.files })
+	}
+	for _, file := range pkg.Tests {
+		add(file, func(v *variant) *[]*ast.File { return &v.tests })
+	}
+	for _, file := range pkg.ExternalTests {
+		add(file, func(v *variant) *[]*ast.File { return &v.xtests })
+	}
+	if len(order) == 1 {
+		return []*variant{groups[order[0]]}
+	}
+
+	var out []*variant
+	used := map[string]bool{}
+	for _, key := range order {
+		v := groups[key]
+		if key != "" {
+			expr, _ := constraint.Parse(v.buildLine)
+			v.label = constraintLabel(expr)
+			for base, i := v.label, 2; used[v.label]; i++ {
+				v.label = fmt.Sprintf("%s%d", base, i)
+			}
+			used[v.label] = true
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// effectiveConstraint renders the build expression a file compiles
+// under, or "" when it has none.
+func effectiveConstraint(file *ast.File, suffix string) string {
+	var exprs []constraint.Expr
+	if _, line := fileHeader(file); line != "" {
+		if expr, err := constraint.Parse(line); err == nil {
+			exprs = append(exprs, expr)
+		}
+	}
+	if suffix != "" {
+		if expr, err := constraint.Parse("//go:build " + suffixConstraint(suffix)); err == nil {
+			exprs = append(exprs, expr)
+		}
+	}
+	switch len(exprs) {
+	case 0:
+		return ""
+	case 1:
+		return exprs[0].String()
+	}
+	return (&constraint.AndExpr{X: exprs[0], Y: exprs[1]}).String()
+}
+
+// constraintLabel turns an expression into a file-name fragment,
+// e.g. "linux && !cgo" -> "linux_nocgo".
+func constraintLabel(expr constraint.Expr) string {
+	switch x := expr.(type) {
+	case *constraint.TagExpr:
+		return x.Tag
+	case *constraint.NotExpr:
+		return "no" + constraintLabel(x.X)
+	case *constraint.AndExpr:
+		return constraintLabel(x.X) + "_" + constraintLabel(x.Y)
+	case *constraint.OrExpr:
+		return constraintLabel(x.X) + "_or_" + constraintLabel(x.Y)
+	}
+	return "variant"
+}
@@ -0,0 +1,237 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+)
+
+// 5. INTERFACE LAYOUT
+// ---------------------------------------------------------
+
+var implementsDoc = regexp.MustCompile(`\bimplements\s+(\w+)`)
+
+// splitInterfaces pulls every interface declaration out of decls into a
+// group of its own. With withImpls, types documented as implementing an
+// interface (via a "var _ I = ..." assertion or an "implements I" doc
+// comment) follow it, together with their methods and the assertion.
+func splitInterfaces(decls, methods []ast.Decl, withImpls bool) (rest, restMethods []ast.Decl, groups []declGroup) {
+	index := map[string]int{}
+	var flat []*ast.GenDecl
+	for _, decl := range decls {
+		d := decl.(*ast.GenDecl)
+		if d.Tok == token.TYPE && hasInterface(d) {
+			flat = append(flat, splitGenDecl(d)...)
+		} else {
+			flat = append(flat, d)
+		}
+	}
+
+	for _, d := range flat {
+		if name, ok := interfaceName(d); ok {
+			index[name] = len(groups)
+			groups = append(groups, declGroup{name: name, decls: []ast.Decl{d}})
+		}
+	}
+	if len(groups) == 0 {
+		return decls, methods, nil
+	}
+
+	implOf := map[string]string{} // type name -> interface name
+	if withImpls {
+		for _, d := range flat {
+			for iface, typ := range assertions(d) {
+				if _, ok := index[iface]; ok {
+					implOf[typ] = iface
+				}
+			}
+			if d.Tok != token.TYPE || len(d.Specs) != 1 {
+				continue
+			}
+			spec := d.Specs[0].(*ast.TypeSpec)
+			doc := spec.Doc
+			if doc == nil {
+				doc = d.Doc
+			}
+			if doc == nil {
+				continue
+			}
+			if m := implementsDoc.FindStringSubmatch(doc.Text()); m != nil {
+				if _, ok := index[m[1]]; ok {
+					implOf[spec.Name.Name] = m[1]
+				}
+			}
+		}
+	}
+
+	for _, d := range flat {
+		if _, ok := interfaceName(d); ok {
+			continue
+		}
+		target := ""
+		if d.Tok == token.TYPE && len(d.Specs) == 1 {
+			target = implOf[d.Specs[0].(*ast.TypeSpec).Name.Name]
+		}
+		for iface, typ := range assertions(d) {
+			if implOf[typ] == iface {
+				target = iface
+			}
+		}
+		if target != "" {
+			groups[index[target]].decls = append(groups[index[target]].decls, d)
+		} else {
+			rest = append(rest, d)
+		}
+	}
+	for _, decl := range methods {
+		if iface, ok := implOf[receiverName(decl.(*ast.FuncDecl))]; ok {
+			groups[index[iface]].decls = append(groups[index[iface]].decls, decl)
+		} else {
+			restMethods = append(restMethods, decl)
+		}
+	}
+	return rest, restMethods, groups
+}
+
+func hasInterface(d *ast.GenDecl) bool {
+	for _, spec := range d.Specs {
+		if _, ok := spec.(*ast.TypeSpec).Type.(*ast.InterfaceType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// interfaceName reports the name of a single-spec interface declaration.
+func interfaceName(d *ast.GenDecl) (string, bool) {
+	if d.Tok != token.TYPE || len(d.Specs) != 1 {
+		return "", false
+	}
+	spec := d.Specs[0].(*ast.TypeSpec)
+	if _, ok := spec.Type.(*ast.InterfaceType); !ok {
+		return "", false
+	}
+	return spec.Name.Name, true
+}
+
+// splitGenDecl breaks a parenthesized declaration into one per spec.
+func splitGenDecl(d *ast.GenDecl) []*ast.GenDecl {
+	if !d.Lparen.IsValid() || len(d.Specs) < 2 {
+		return []*ast.GenDecl{d}
+	}
+	out := make([]*ast.GenDecl, len(d.Specs))
+	for i, spec := range d.Specs {
+		// Hoist the spec's doc so it prints above the keyword
+		var doc *ast.CommentGroup
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			doc, s.Doc = s.Doc, nil
+		case *ast.ValueSpec:
+			doc, s.Doc = s.Doc, nil
+		}
+		out[i] = &ast.GenDecl{Doc: doc, TokPos: spec.Pos(), Tok: d.Tok, Specs: []ast.Spec{spec}}
+	}
+	return out
+}
+
+// assertions maps interface -> type for declarations of the form
+// var _ I = (*T)(nil), T{}, &T{} or new(T).
+func assertions(d *ast.GenDecl) map[string]string {
+	if d.Tok != token.VAR {
+		return nil
+	}
+	found := map[string]string{}
+	for _, spec := range d.Specs {
+		vs := spec.(*ast.ValueSpec)
+		iface, ok := vs.Type.(*ast.Ident)
+		if !ok || len(vs.Names) != 1 || vs.Names[0].Name != "_" || len(vs.Values) != 1 {
+			continue
+		}
+		if typ := exprTypeName(vs.Values[0]); typ != "" {
+			found[iface.Name] = typ
+		}
+	}
+	return found
+}
+
+func exprTypeName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.ParenExpr:
+		return exprTypeName(e.X)
+	case *ast.StarExpr:
+		return exprTypeName(e.X)
+	case *ast.UnaryExpr:
+		return exprTypeName(e.X)
+	case *ast.CompositeLit:
+		return exprTypeName(e.Type)
+	case *ast.CallExpr:
+		if fn, ok := e.Fun.(*ast.Ident); ok && fn.Name == "new" && len(e.Args) == 1 {
+			return exprTypeName(e.Args[0])
+		}
+		return exprTypeName(e.Fun) // Conversion: (*T)(nil)
+	}
+	return ""
+}
+
+// extractInterfaces renders, for each named concrete type, an interface
+// declaring its exported method set (value and pointer receivers).
+func (g *Generator) extractInterfaces(names []string, typeDecls, methods []ast.Decl) ([]ast.Decl, error) {
+	specs := map[string]*ast.TypeSpec{}
+	for _, decl := range typeDecls {
+		d := decl.(*ast.GenDecl)
+		if d.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range d.Specs {
+			ts := spec.(*ast.TypeSpec)
+			specs[ts.Name.Name] = ts
+		}
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "package %s\n", g.PackageName)
+	for _, name := range names {
+		ts, ok := specs[name]
+		switch {
+		case !ok:
+			warnf("No type %s to extract an interface from", name)
+			continue
+		case ts.TypeParams != nil:
+			warnf("Skipping generic type %s for interface extraction", name)
+			continue
+		}
+
+		fmt.Fprintf(&src, "\n// %sInterface is the method set of %s.\ntype %sInterface interface {\n", name, name, name)
+		for _, decl := range methods {
+			fn := decl.(*ast.FuncDecl)
+			if receiverName(fn) != name || !fn.Name.IsExported() {
+				continue
+			}
+			var sig bytes.Buffer
+			if err := format.Node(&sig, g.Fset, fn.Type); err != nil {
+				return nil, err
+			}
+			if fn.Doc != nil {
+				for _, line := range strings.Split(strings.TrimSpace(fn.Doc.Text()), "\n") {
+					fmt.Fprintf(&src, "\t// %s\n", line)
+				}
+			}
+			fmt.Fprintf(&src, "\t%s%s\n", fn.Name.Name, strings.TrimPrefix(sig.String(), "func"))
+		}
+		src.WriteString("}\n")
+	}
+
+	file, err := parser.ParseFile(g.Fset, "interfaces.go", src.Bytes(), parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	g.trackComments(file)
+	return file.Decls, nil
+}
@@ -0,0 +1,215 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 6. INTERNAL HELPER RELOCATION
+// ---------------------------------------------------------
+
+const helpersPkg = "helpers"
+
+// relocateHelpers moves unexported, self-contained functions into
+// internal/helpers and leaves forwarders behind. A function qualifies
+// when neither its signature nor its body refers to package-level names
+// other than other qualifying functions.
+func (g *Generator) relocateHelpers(funcs, typeDecls []ast.Decl) (rest, moved, forwarders []ast.Decl, err error) {
+	pkgNames := map[string]bool{}
+	for _, decl := range append(append([]ast.Decl{}, typeDecls...), funcs...) {
+		for _, name := range declNames(decl) {
+			pkgNames[name] = true
+		}
+	}
+
+	candidates := map[string]*ast.FuncDecl{}
+	for _, decl := range funcs {
+		fn := decl.(*ast.FuncDecl)
+		name := fn.Name.Name
+		if name == "init" || name == "main" || !unicode.IsLower(rune(name[0])) || fn.Type.TypeParams != nil || hasDirective(fn.Doc) {
+			continue
+		}
+		candidates[name] = fn
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, fn := range candidates {
+			for ref := range g.packageRefs(fn, name, pkgNames) {
+				if _, ok := candidates[ref]; !ok {
+					delete(candidates, name)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return funcs, nil, nil, nil
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "package %s\n", g.PackageName)
+	for _, decl := range funcs {
+		fn := decl.(*ast.FuncDecl)
+		if _, ok := candidates[fn.Name.Name]; !ok {
+			rest = append(rest, decl)
+			continue
+		}
+		fwd, err := g.forwarder(fn)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		src.WriteString(fwd)
+		moved = append(moved, decl)
+	}
+
+	// Rename only after the forwarders captured the original names
+	for _, decl := range moved {
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				ast.Inspect(sel.X, func(n ast.Node) bool { return renameHelper(n, candidates) })
+				return false
+			}
+			return renameHelper(n, candidates)
+		})
+	}
+
+	file, err := parser.ParseFile(g.Fset, "forwarders.go", src.Bytes(), parser.ParseComments)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	g.trackComments(file)
+	return rest, moved, file.Decls, nil
+}
+
+// helpersImport is the import the forwarders need.
+func (g *Generator) helpersImport() *ast.ImportSpec {
+	return &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(importPath(g.ProjectName, "internal", helpersPkg))}}
+}
+
+// forwarder renders fn as a call into the helpers package, naming any
+// anonymous or blank parameters so they can be passed through.
+func (g *Generator) forwarder(fn *ast.FuncDecl) (string, error) {
+	var args []string
+	variadic := false
+	i := 0
+	for _, field := range fn.Type.Params.List {
+		if len(field.Names) == 0 {
+			field.Names = []*ast.Ident{ast.NewIdent(fmt.Sprintf("p%d", i))}
+		}
+		for _, name := range field.Names {
+			if name.Name == "_" {
+				name.Name = fmt.Sprintf("p%d", i)
+			}
+			args = append(args, name.Name)
+			i++
+		}
+		_, variadic = field.Type.(*ast.Ellipsis)
+	}
+	call := fmt.Sprintf("%s.%s(%s", helpersPkg, exportName(fn.Name.Name), strings.Join(args, ", "))
+	if variadic {
+		call += "..."
+	}
+	call += ")"
+	if fn.Type.Results != nil && len(fn.Type.Results.List) > 0 {
+		call = "return " + call
+	}
+
+	var sig bytes.Buffer
+	if err := format.Node(&sig, g.Fset, fn.Type); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("\nfunc %s%s {\n\t%s\n}\n", fn.Name.Name, strings.TrimPrefix(sig.String(), "func"), call), nil
+}
+
+func renameHelper(n ast.Node, moved map[string]*ast.FuncDecl) bool {
+	if id, ok := n.(*ast.Ident); ok {
+		if _, ok := moved[id.Name]; ok {
+			id.Name = exportName(id.Name)
+		}
+	}
+	return true
+}
+
+// packageRefs collects the package-level names node refers to, other
+// than self. Without type information it goes by identifier alone and
+// ignores shadowing, which only ever overestimates references.
+func (g *Generator) packageRefs(node ast.Node, self string, pkgNames map[string]bool) map[string]bool {
+	refs := map[string]bool{}
+	if info, pkg := g.typesInfo(node), g.typesPkg(node); info != nil && pkg != nil {
+		ast.Inspect(node, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && id.Name != self {
+				obj := info.Uses[id]
+				if obj != nil && obj.Pkg() == pkg && obj.Parent() == pkg.Scope() {
+					refs[id.Name] = true
+				}
+			}
+			return true
+		})
+		return refs
+	}
+
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(x.X, visit)
+			return false
+		case *ast.Ident:
+			if pkgNames[x.Name] && x.Name != self {
+				refs[x.Name] = true
+			}
+		}
+		return true
+	}
+	ast.Inspect(node, visit)
+	return refs
+}
+
+// declNames lists the package-level names a declaration introduces.
+func declNames(decl ast.Decl) []string {
+	var names []string
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv == nil {
+			names = append(names, d.Name.Name)
+		}
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				names = append(names, s.Name.Name)
+			case *ast.ValueSpec:
+				for _, n := range s.Names {
+					if n.Name != "_" {
+						names = append(names, n.Name)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+func hasDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.HasPrefix(c.Text, "//go:") {
+			return true
+		}
+	}
+	return false
+}
+
+func exportName(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
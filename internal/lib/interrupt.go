@@ -0,0 +1,229 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+// 45. INTERRUPTS
+// ---------------------------------------------------------
+
+// ErrInterrupted is what a run stopped by Interrupt returns.
+var ErrInterrupted = errors.New("interrupted")
+
+// runCtx is cancelled by Interrupt; every go (or git, tinygo) process and
+// HTTP request of a run is tied to it, see runContext.
+var (
+	runMu           sync.Mutex
+	runCtx, stopRun = context.WithCancel(context.Background())
+)
+
+// Interrupt stops the run in progress, for a SIGINT or SIGTERM: the
+// processes it spawned are killed and it returns ErrInterrupted at the
+// next phase. Deferred cleanup still runs on the way out, removing the
+// scratch directories and the run lock, and putting the output (and a
+// shared third_party) back as it was before the run, see backup.
+func Interrupt() {
+	runMu.Lock()
+	defer runMu.Unlock()
+	stopRun()
+}
+
+// Interrupted reports whether Interrupt was called, or the context of
+// RunContext cancelled.
+func Interrupted() bool {
+	return runContext().Err() != nil
+}
+
+// RunContext runs f with ctx as the context of the runs it starts:
+// cancelling ctx interrupts them as Interrupt does. Interrupt itself
+// only reaches f's runs while it is running.
+func RunContext(ctx context.Context, f func() error) error {
+	runMu.Lock()
+	prevCtx, prevStop := runCtx, stopRun
+	runCtx, stopRun = context.WithCancel(ctx)
+	runMu.Unlock()
+	defer func() {
+		runMu.Lock()
+		stopRun()
+		runCtx, stopRun = prevCtx, prevStop
+		runMu.Unlock()
+	}()
+	return f()
+}
+
+// runContext is the context of the run in progress.
+func runContext() context.Context {
+	runMu.Lock()
+	defer runMu.Unlock()
+	return runCtx
+}
+
+// checkInterrupt returns ErrInterrupted once Interrupt was called, for
+// the phases of a run to stop at.
+func checkInterrupt() error {
+	if Interrupted() {
+		return ErrInterrupted
+	}
+	return nil
+}
+
+// command is exec.Command for a process Interrupt kills.
+func command(name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(runContext(), name, args...)
+}
+
+// backup puts a directory the run writes to back as it was, should the
+// run be interrupted. Nothing is copied up front: before the run first
+// changes or removes a file there, touch copies it aside, to
+// backupPath(dir), or notes that the run is creating it. A shared
+// third_party, of which a run changes a handful of files, so costs no
+// more than those.
+type backup struct {
+	dir, saved string
+	existed    bool            // whether dir was there before the run
+	touched    map[string]bool // paths relative to dir, saved or created
+	created    []string        // paths the run added, relative to dir
+}
+
+// backupDir starts the backup of dir.
+func backupDir(dir string) (*backup, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	b := &backup{dir: abs, saved: backupPath(abs), touched: map[string]bool{}}
+	if err := os.RemoveAll(b.saved); err != nil {
+		return nil, err
+	}
+	_, err = os.Lstat(abs)
+	b.existed = err == nil
+	return b, nil
+}
+
+// touch records p, a file or directory the run is about to write or
+// remove, the first time it comes by: a copy of it when it exists, the
+// fact that the run creates it otherwise.
+func (b *backup) touch(p string) error {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(b.dir, abs)
+	if err != nil || !filepath.IsLocal(rel) || !b.existed || b.touched[rel] {
+		return nil
+	}
+	b.touched[rel] = true
+	if _, err := os.Lstat(longPath(abs)); os.IsNotExist(err) {
+		// Whatever directories the run makes on the way go with it
+		for parent := filepath.Dir(abs); parent != b.dir; parent = filepath.Dir(parent) {
+			if _, err := os.Lstat(longPath(parent)); err == nil {
+				break
+			}
+			abs = parent
+		}
+		rel, _ = filepath.Rel(b.dir, abs)
+		b.created = append(b.created, rel)
+		return nil
+	}
+	saved := filepath.Join(b.saved, rel)
+	if err := os.MkdirAll(filepath.Dir(saved), 0755); err != nil {
+		return err
+	}
+	return copyDir(longPath(abs), longPath(saved))
+}
+
+// moveAside moves p, which the run replaces whole, into the backup
+// instead of copying it, reporting whether it did. It does not when p
+// lies outside dir or was recorded already.
+func (b *backup) moveAside(p string) (bool, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(b.dir, abs)
+	if err != nil || !filepath.IsLocal(rel) || !b.existed || b.touched[rel] {
+		return false, nil
+	}
+	saved := filepath.Join(b.saved, rel)
+	if err := os.MkdirAll(filepath.Dir(saved), 0755); err != nil {
+		return false, err
+	}
+	if err := os.Rename(longPath(abs), longPath(saved)); err != nil {
+		return false, err
+	}
+	b.touched[rel] = true
+	return true, nil
+}
+
+// restore puts dir back as the backup found it: without what the run
+// created, and with what it changed or removed copied back.
+func (b *backup) restore() {
+	if !b.existed {
+		os.RemoveAll(b.dir)
+		return
+	}
+	var errs []error
+	for i := len(b.created) - 1; i >= 0; i-- {
+		errs = append(errs, os.RemoveAll(longPath(filepath.Join(b.dir, b.created[i]))))
+	}
+	for rel := range b.touched {
+		saved := filepath.Join(b.saved, rel)
+		if _, err := os.Lstat(longPath(saved)); err != nil {
+			continue // Created by the run
+		}
+		target := filepath.Join(b.dir, rel)
+		errs = append(errs,
+			os.RemoveAll(longPath(target)),
+			os.MkdirAll(filepath.Dir(target), 0755),
+			os.Rename(longPath(saved), longPath(target)))
+	}
+	if err := errors.Join(errs...); err != nil {
+		warnf("Could not restore %s from %s: %v", b.dir, b.saved, err)
+		return
+	}
+	os.RemoveAll(b.saved)
+}
+
+// discard drops the copies once the run got through.
+func (b *backup) discard() {
+	os.RemoveAll(b.saved)
+}
+
+// touch lets each backup of the run record paths before they are
+// written or removed, see backup.
+func (g *Generator) touch(paths ...string) error {
+	for _, b := range g.backups {
+		for _, p := range paths {
+			if err := b.touch(p); err != nil {
+				return fmt.Errorf("backing up %s: %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setAside clears p, a file or directory the run replaces whole: into
+// the backup holding it, which costs a rename, or for good when none
+// does or it was backed up already.
+func (g *Generator) setAside(p string) error {
+	if _, err := os.Lstat(longPath(p)); os.IsNotExist(err) {
+		return g.touch(p)
+	}
+	for _, b := range g.backups {
+		if moved, err := b.moveAside(p); err != nil || moved {
+			return err
+		}
+	}
+	return os.RemoveAll(longPath(p))
+}
+
+// backupPath is next to dir, on the same file system for the rename.
+func backupPath(dir string) string {
+	return filepath.Clean(dir) + ".backup"
+}
@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestBackupRestore changes, adds, replaces and removes files under a
+// backed-up directory and checks restore undoes all of it.
+func TestBackupRestore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	writeTree(t, dir, map[string]string{
+		"go.mod":                 "module out\n",
+		"p_methods.go":           "package p\n",
+		"third_party/m/m.go":     "package m // v1\n",
+		"third_party/m/extra.go": "package m\n",
+		"third_party/kept/k.go":  "package kept\n",
+	})
+	before := treeSums(t, dir)
+
+	b, err := backupDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &Generator{OutputDir: dir, backups: []*backup{b}}
+	if err := g.touch(filepath.Join(dir, "go.mod"), filepath.Join(dir, "p_methods.go"), filepath.Join(dir, "new", "deep", "n.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.setAside(filepath.Join(dir, "third_party", "m")); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "p_methods.go"))
+	writeTree(t, dir, map[string]string{
+		"go.mod":             "module out\n\ngo 1.22\n",
+		"new/deep/n.go":      "package deep\n",
+		"third_party/m/m.go": "package m // v2\n",
+	})
+
+	b.restore()
+	if after := treeSums(t, dir); !maps.Equal(before, after) {
+		t.Errorf("restore left\n%v\nwant\n%v", after, before)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "new")); !os.IsNotExist(err) {
+		t.Errorf("restore kept the directory the run made: %v", err)
+	}
+	if _, err := os.Stat(backupPath(dir)); !os.IsNotExist(err) {
+		t.Errorf("restore kept %s: %v", backupPath(dir), err)
+	}
+}
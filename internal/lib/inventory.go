@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"go/ast"
+	"strconv"
+	"strings"
+)
+
+// 23. LOW-LEVEL INVENTORY
+// ---------------------------------------------------------
+
+// lowLevelUses lists how a package steps outside memory-safe, portable
+// Go: importing unsafe or syscall, using cgo, or shipping assembly.
+func lowLevelUses(files []*ast.File, sources []string) []string {
+	var uses []string
+	seen := map[string]bool{}
+	add := func(use string) {
+		if !seen[use] {
+			seen[use] = true
+			uses = append(uses, use)
+		}
+	}
+	for _, file := range files {
+		for _, imp := range file.Imports {
+			switch p, _ := strconv.Unquote(imp.Path.Value); p {
+			case "unsafe":
+				add("unsafe")
+			case "syscall":
+				add("syscall")
+			case "C":
+				add("cgo")
+			}
+		}
+	}
+	for _, name := range sources {
+		if strings.HasSuffix(name, ".s") || strings.HasSuffix(name, ".S") {
+			add("assembly")
+			break
+		}
+	}
+	return uses
+}
+
+// recordLowLevel notes a shaded package's low-level uses in the report,
+// for teams auditing what they vendor.
+func (g *Generator) recordLowLevel(pkgPath string, files []*ast.File, sources []string) {
+	uses := lowLevelUses(files, sources)
+	if len(uses) == 0 {
+		return
+	}
+	if g.report.LowLevel == nil {
+		g.report.LowLevel = map[string][]string{}
+	}
+	g.report.LowLevel[pkgPath] = uses
+}
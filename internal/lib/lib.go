@@ -0,0 +1,1374 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options tweak how the input is split and shaded.
+type Options struct {
+	MethodsByReceiver bool `json:"by_receiver"`     // one _methods file per receiver type
+	InterfaceFiles    bool `json:"interface_files"` // one file per interface declaration
+	WithImpls         bool `json:"with_impls"`      // with InterfaceFiles, move documented implementations along
+
+	// Files spreads the declarations over this many files of about equal
+	// length (mylib_1.go, ...) in place of the kind buckets, keeping each
+	// type with its methods; zero keeps the kind buckets.
+	Files int `json:"files"`
+
+	ExtractInterfaces []string `json:"extract_interfaces"` // concrete types to emit interfaces.go declarations for
+	InternalHelpers   bool     `json:"internal_helpers"`   // move self-contained unexported funcs to internal/helpers
+
+	// Subpackages maps subpackage names to patterns (path.Match syntax)
+	// selecting the declarations they receive.
+	Subpackages   map[string][]string `json:"subpackages"`
+	CycleStrategy string              `json:"cycles"` // "merge" folds cyclic subpackages together; otherwise cycles are reported
+
+	// Link symlinks modules into third_party from the module cache instead
+	// of copying them. Their imports are checked but left unrewritten, so
+	// the output is for local iteration only.
+	Link bool `json:"link"`
+
+	// SharedThirdParty shades into this directory, a module of its own
+	// named after its base name, instead of each output's third_party, so
+	// several outputs generated from one repo share a single copy.
+	SharedThirdParty string `json:"shared_third_party"`
+
+	// PruneDirs names directories (examples, cmd, ...) dropped from shaded
+	// modules unless a vendored package lives in or embeds them. nil means
+	// DefaultPruneDirs; an empty slice prunes nothing.
+	PruneDirs []string `json:"prune"`
+
+	// FlatThirdParty drops the host from third_party paths
+	// (third_party/pkg/errors rather than third_party/github.com/pkg/errors).
+	FlatThirdParty bool `json:"flat"`
+
+	// Mangle renames the unexported package-level identifiers of shaded
+	// packages and strips their comments and layout, for embedding into
+	// distributed artifacts. Packages using assembly, cgo or linkname are
+	// left as they are.
+	Mangle bool `json:"mangle"`
+
+	// StripComments names the generated code to drop comments from; only
+	// "third_party" is supported. License headers, build constraints and
+	// directives stay.
+	StripComments string `json:"strip_comments"`
+
+	// MaxThirdPartySize fails the run when third_party ends up larger, in
+	// bytes; zero means no limit.
+	MaxThirdPartySize int64 `json:"max_third_party_size"`
+
+	// RewriteStrings points string literals naming a shaded module (error
+	// prefixes, registry keys) at its shaded path; every change is reported.
+	RewriteStrings bool `json:"rewrite_strings"`
+
+	// AllowLicenses and DenyLicenses are SPDX ids (or prefixes such as
+	// "GPL") shaded modules must or must not carry. LicensePolicy "warn"
+	// only reports violations; otherwise they fail the run.
+	AllowLicenses []string `json:"allow_licenses"`
+	DenyLicenses  []string `json:"deny_licenses"`
+	LicensePolicy string   `json:"license_policy"`
+
+	// VerifyPlatforms lists GOOS/GOARCH pairs the generated module must
+	// build for; the run fails if any of them does not.
+	VerifyPlatforms []string `json:"verify_platforms"`
+
+	// HeaderFiles is a glob of generated file names that carry the input's
+	// license banner; "" means all, "-" none. Build constraints are always kept.
+	HeaderFiles string `json:"header_files"`
+
+	// Nested writes the output as a nested module at the root of the
+	// input's module, with a module path beneath it, rather than as a
+	// sibling directory.
+	Nested bool `json:"nested"`
+
+	// Zip is a module version (v1.2.3); when set, the output is also
+	// packaged as the module zip a proxy would serve for it, written next
+	// to the output directory.
+	Zip string `json:"zip"`
+
+	// Namespace is the import path shaded packages are rewritten under
+	// (corp.example.com/shaded/github.com/pkg/errors) in place of
+	// ProjectName/third_party. third_party then becomes a module of that
+	// path, which the output requires through a local replace.
+	Namespace string `json:"namespace"`
+
+	// Tools carries the input module's tool dependencies (go.mod tool
+	// directives, tools.go blank imports) over to the output, pointed at
+	// their shaded copies.
+	Tools bool `json:"tools"`
+
+	// CheckUpstream asks the module proxy whether shaded modules are
+	// deprecated or their versions retracted, warning about each.
+	CheckUpstream bool `json:"check_upstream"`
+
+	// DepsDev adds the latest version, stars and OpenSSF scorecard of
+	// each shaded module, from deps.dev, to the dependency summary.
+	DepsDev bool `json:"deps_dev"`
+
+	// Concurrency caps bradley's simultaneous HTTP requests (default 4),
+	// RateLimit their rate per second (zero is unlimited), and Retries
+	// how often a failed one is retried with backoff (zero means 3,
+	// negative none), see network.
+	Concurrency int     `json:"concurrency"`
+	RateLimit   float64 `json:"rate_limit"`
+	Retries     int     `json:"retries"`
+
+	// Index writes INDEX.md, listing each exported symbol of the output
+	// with the package and file that declare it.
+	Index bool `json:"index"`
+
+	// Overlay splits the input in place, for go build -overlay, rather
+	// than into a new module: see writeOverlay.
+	Overlay bool `json:"overlay"`
+
+	// NoCache turns off the cache of goimports results kept across runs
+	// in the user cache directory, see processImports.
+	NoCache bool `json:"no_cache"`
+}
+
+type Generator struct {
+	Options
+	Fset          *token.FileSet
+	ProjectName   string // e.g., "mylib_split"
+	PackageName   string // e.g., "mylib_split", or "main" for commands
+	OutputDir     string // e.g., "./mylib_split"
+	ThirdPartyDir string // e.g., "./mylib_split/third_party"
+	ImportPrefix  string // e.g., "mylib_split/third_party"
+
+	modules    []LockedModule                 // shaded modules, filled by setupThirdParty
+	parsed     map[*token.File]*ast.File      // parsed inputs, for their comments, see trackComments
+	banner     string                         // license banner above the input's package clause
+	buildLine  string                         // constraint of the variant being written
+	types      map[*token.File]typedFile      // type information, for files go/packages loaded
+	moved      map[string]string              // original import path -> path in the output module
+	layout     map[string]string              // shaded module -> its path under third_party, see planLayout
+	memory     map[string][]byte              // output collected in memory, see GenerateInMemory; nil writes to disk
+	vendored   string                         // copy of the first go mod vendor of a run, see GenerateProfiles
+	moduleDir  string                         // root of the input's module, where go commands about its dependencies run
+	modFile    string                         // scratch go.mod those commands use instead of the module's, see scratchModfile
+	backups    []*backup                      // of the directories the run writes to, see touch
+	vendorDir  string                         // go mod vendor output, in a scratch directory outside the input module
+	snapshot   map[string]fileStamp           // files of the input's module before the run, see checkUntouched
+	guarded    []guardedDir                   // where snapshot was taken, see guardModule
+	goVersion  string                         // the input module's go directive, see targetGoVersion
+	packageDoc string                         // with Files, the package comment for the first file, see writeDoc
+	docHere    bool                           // the bucket being written takes packageDoc
+	claimed    map[string]bool                // generated source files, lowercased, see claim
+	created    []string                       // what the run wrote into OutputDir, relative to it, see Lock.Files
+	overlayDir string                         // with Overlay, the input package's directory
+	splitFiles []string                       // with Overlay, the input files the split replaces
+	net        *network                       // paces HTTP requests
+	placed     map[types.Object]string        // declaration -> subpackage it was written to, see writeSubpackages
+	qualified  map[*ast.Ident]*ast.ImportSpec // identifiers qualified with another package -> its import
+
+	report                      *Report           // filled as the run goes, see writeReport
+	stringPattern               *regexp.Regexp    // shaded module paths in literals, see rewriteStrings
+	keptImports, offeredImports map[string]bool   // paths kept / import keys offered to buckets
+	importNames                 map[string]string // import path -> name its package declares, from type information
+}
+
+func NewGenerator(inputFile string, opts Options) *Generator {
+	name, _ := primaryPackage(inputFile)
+	return newGenerator(name, commandName(inputFile), opts)
+}
+
+// newGenerator names the output after package name, or after command
+// when the input is a main package.
+func newGenerator(name, command string, opts Options) *Generator {
+	pkgName := name + "_split"
+	clause := pkgName
+	if name == "main" {
+		// "main_split" would be neither a runnable package nor a sensible
+		// module path; name the module after the command's directory.
+		pkgName = command + "_split"
+		clause = "main"
+	}
+	g := &Generator{
+		Options:     opts,
+		Fset:        token.NewFileSet(),
+		PackageName: clause,
+		report:      &Report{},
+		net:         newNetwork(opts),
+	}
+	g.setOutput(pkgName)
+	return g
+}
+
+// setOutput names the output module and its directory, with third_party
+// beneath it unless shared or namespaced.
+func (g *Generator) setOutput(name string) {
+	g.ProjectName, g.OutputDir = name, name
+	g.ThirdPartyDir = filepath.Join(name, "third_party")
+	g.ImportPrefix = importPath(name, "third_party")
+	if g.SharedThirdParty != "" {
+		g.ThirdPartyDir = g.SharedThirdParty
+		g.ImportPrefix = sharedPrefix(g.SharedThirdParty)
+	}
+	if g.Namespace != "" {
+		g.ImportPrefix = g.Namespace
+	}
+}
+
+// 1. AST MAPPING & REWRITING
+// ---------------------------------------------------------
+
+func (g *Generator) rewriteImportsInFile(file *ast.File) bool {
+	changed := false
+	for _, imp := range file.Imports {
+		pathVal := strings.Trim(imp.Path.Value, `"`)
+		if isThirdParty(pathVal) && !hasPathPrefix(pathVal, g.ImportPrefix) && !hasPathPrefix(pathVal, g.ProjectName) {
+			newPath := importPath(g.ImportPrefix, g.shadedPath(pathVal))
+			imp.Path.Value = fmt.Sprintf(`"%s"`, newPath)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// rewriteFile applies every shading rewrite to a file of the output,
+// named relative to OutputDir: imports, linkname targets, and with
+// RewriteStrings string literals.
+func (g *Generator) rewriteFile(file *ast.File, name string) bool {
+	changed := g.rewriteImportsInFile(file)
+	shaded := hasPathPrefix(name, "third_party") || g.SharedThirdParty != "" && strings.HasPrefix(name, "../")
+	if g.rewriteLinknames(file, name, shaded) {
+		changed = true
+	}
+	if g.RewriteStrings && g.rewriteStrings(file, name) {
+		changed = true
+	}
+	return changed
+}
+
+func (g *Generator) processDirectoryImports(root string) error {
+	return filepath.Walk(longPathRoot(root), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".go") {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil // Linked into the module cache, see linkModules
+		}
+		file, err := parser.ParseFile(g.Fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(longPathRoot(root), path)
+		name, _ := filepath.Rel(g.OutputDir, filepath.Join(root, rel))
+		if g.rewriteFile(file, slashPath(name)) {
+			if err := g.touch(path); err != nil {
+				return err
+			}
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return format.Node(f, g.Fset, file)
+		}
+		return nil
+	})
+}
+
+// 2. FILE GENERATION
+// ---------------------------------------------------------
+
+func (g *Generator) writeBucket(filename, pkgName string, decls []ast.Decl, availableImports []*ast.ImportSpec) error {
+	if len(decls) == 0 {
+		return nil
+	}
+	if err := g.claim(filename); err != nil {
+		return err
+	}
+
+	var optimized []byte
+	if needed, ok := g.preciseImports(decls, availableImports); ok {
+		// Type information says exactly what the bucket imports
+		src, err := g.renderBucket(filename, pkgName, decls, needed)
+		if err != nil {
+			return err
+		}
+		if optimized, err = format.Source(src); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	} else {
+		src, err := g.renderBucket(filename, pkgName, decls, availableImports)
+		if err != nil {
+			return err
+		}
+		if g.memory != nil {
+			// goimports may consult the go command and module cache
+			if optimized, err = pruneImports(src); err != nil {
+				err = fmt.Errorf("%s: %w", filename, err)
+			}
+		} else {
+			// Clean up unused imports immediately via goimports
+			optimized, err = g.processImports(filename, src)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	g.recordImports(filename, availableImports, optimized)
+	return g.emit(filename, optimized)
+}
+
+// claim reserves name for one generated source file, failing when two
+// buckets (or a bucket and a file kept intact) come out under the same
+// name, where the second would silently overwrite the first.
+func (g *Generator) claim(name string) error {
+	if g.claimed == nil {
+		g.claimed = map[string]bool{}
+	}
+	key := strings.ToLower(slashPath(name)) // Case-insensitive file systems
+	if g.claimed[key] {
+		return fmt.Errorf("%s: two generated files get this name; rename the input file or declaration it is named after", name)
+	}
+	g.claimed[key] = true
+	return nil
+}
+
+// emit writes a generated file, named relative to OutputDir.
+func (g *Generator) emit(name string, data []byte) error {
+	if g.memory != nil {
+		g.memory[slashPath(name)] = data
+		return nil
+	}
+	target := filepath.Join(g.OutputDir, name)
+	if err := g.touch(target); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(target, data, 0644); err != nil {
+		return err
+	}
+	g.created = append(g.created, slashPath(name))
+	SendEvent(Event{Type: "file", File: target})
+	return nil
+}
+
+// recordCreated adds the file p, or every file under the directory p,
+// when it exists and lies in OutputDir, to what the run created there.
+// Files are listed one by one so Clean removes only those, never what
+// was added beside them. Those of a shared third_party, outside, are
+// never cleaned with one output.
+func (g *Generator) recordCreated(p string) {
+	base, err := filepath.Rel(g.OutputDir, p)
+	if err != nil || !filepath.IsLocal(base) {
+		return
+	}
+	root := longPathRoot(p)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(root, path); err == nil {
+			g.created = append(g.created, slashPath(filepath.Join(base, rel)))
+		}
+		return nil
+	})
+}
+
+// preciseImports computes the imports decls use from their resolved
+// identifiers. Blank and dot imports, which no selector names, carry
+// over from available as they are. It reports false when some decl has
+// no type information, leaving the bucket to goimports.
+func (g *Generator) preciseImports(decls []ast.Decl, available []*ast.ImportSpec) ([]*ast.ImportSpec, bool) {
+	used := map[string]*types.PkgName{}
+	qualified := map[string]*ast.ImportSpec{} // see writeSubpackages
+	for _, decl := range decls {
+		info := g.typesInfo(decl)
+		if info == nil {
+			return nil, false
+		}
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && g.qualified[id] != nil {
+				spec := g.qualified[id]
+				qualified[spec.Path.Value] = spec
+			}
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if id, ok := sel.X.(*ast.Ident); ok && g.qualified[id] == nil {
+					if pn, ok := info.Uses[id].(*types.PkgName); ok {
+						used[pn.Imported().Path()+" "+pn.Name()] = pn
+						g.learnImportName(pn.Imported().Path(), pn.Imported().Name())
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	var specs []*ast.ImportSpec
+	for _, imp := range available {
+		if imp.Name != nil && (imp.Name.Name == "_" || imp.Name.Name == ".") {
+			specs = append(specs, imp)
+		}
+	}
+	keys := make([]string, 0, len(used))
+	for key := range used {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		pn := used[key]
+		path := pn.Imported().Path()
+		spec := &ast.ImportSpec{}
+		if moved, ok := g.moved[path]; ok {
+			// The package now lives at a path whose last element differs
+			path, spec.Name = moved, ast.NewIdent(pn.Name())
+		} else if pn.Name() != pn.Imported().Name() {
+			spec.Name = ast.NewIdent(pn.Name())
+		}
+		spec.Path = &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}
+		specs = append(specs, spec)
+	}
+	for _, key := range slices.Sorted(maps.Keys(qualified)) {
+		specs = append(specs, qualified[key])
+	}
+	return specs, true
+}
+
+// renderBucket prints each declaration on its own, together with the
+// comments its source file holds inside and around it. Printing decls
+// from several files as one synthesized ast.File would drop free-floating
+// comments and let the printer reflow positions across unrelated files.
+func (g *Generator) renderBucket(filename, pkgName string, decls []ast.Decl, availableImports []*ast.ImportSpec) ([]byte, error) {
+	var buf bytes.Buffer
+	if g.buildLine != "" {
+		buf.WriteString(g.buildLine + "\n\n")
+	}
+	if g.wantsBanner(filename) {
+		buf.WriteString(g.banner + "\n\n")
+	}
+	if g.docHere {
+		buf.WriteString(g.packageDoc)
+	}
+	fmt.Fprintf(&buf, "package %s\n\n", pkgName)
+
+	if len(availableImports) > 0 {
+		buf.WriteString("import (\n")
+		for _, imp := range availableImports {
+			if imp.Name != nil {
+				buf.WriteString(imp.Name.Name + " ")
+			}
+			buf.WriteString(imp.Path.Value + "\n")
+		}
+		buf.WriteString(")\n\n")
+	}
+
+	for _, decl := range decls {
+		floating, within, trailing := g.commentsAround(decl)
+		// The printer keeps only the comments from a node's doc comment to
+		// its end (and a spec's own line comment), so those outside are
+		// written here
+		for _, group := range floating {
+			for _, c := range group.List {
+				buf.WriteString(c.Text + "\n")
+			}
+			buf.WriteString("\n")
+		}
+		node := &printer.CommentedNode{Node: decl, Comments: within}
+		if err := format.Node(&buf, g.Fset, node); err != nil {
+			return nil, err
+		}
+		if trailing != nil && trailing != specComment(decl) {
+			for _, c := range trailing.List {
+				buf.WriteString(" " + c.Text)
+			}
+		}
+		buf.WriteString("\n\n")
+	}
+	return buf.Bytes(), nil
+}
+
+func (g *Generator) wantsBanner(filename string) bool {
+	if g.banner == "" || g.HeaderFiles == "-" {
+		return false
+	}
+	if g.HeaderFiles == "" {
+		return true
+	}
+	ok, _ := filepath.Match(g.HeaderFiles, filepath.Base(filename))
+	return ok
+}
+
+// trackComments records a parsed file's comments so rendered
+// declarations can find the ones that belong to them.
+func (g *Generator) trackComments(file *ast.File) {
+	if g.parsed == nil {
+		g.parsed = map[*token.File]*ast.File{}
+	}
+	g.parsed[g.Fset.File(file.Pos())] = file
+}
+
+type typedFile struct {
+	info *types.Info
+	pkg  *types.Package
+}
+
+func (g *Generator) trackTypes(file *ast.File, info *types.Info, pkg *types.Package) {
+	if g.types == nil {
+		g.types = map[*token.File]typedFile{}
+	}
+	g.types[g.Fset.File(file.Pos())] = typedFile{info, pkg}
+}
+
+// typesInfo returns the type information covering node, or nil when its
+// file was only parsed.
+func (g *Generator) typesInfo(node ast.Node) *types.Info {
+	return g.types[g.Fset.File(node.Pos())].info
+}
+
+// typesPkg returns the type-checked package node belongs to, if any.
+func (g *Generator) typesPkg(node ast.Node) *types.Package {
+	return g.types[g.Fset.File(node.Pos())].pkg
+}
+
+// commentsAround returns the comment groups that go with decl: the
+// free-floating ones between it and the declaration before it, those
+// from its doc comment to its end, and its trailing comment, on the line
+// decl ends.
+func (g *Generator) commentsAround(decl ast.Decl) (floating, within []*ast.CommentGroup, trailing *ast.CommentGroup) {
+	tf := g.Fset.File(decl.Pos())
+	file := g.parsed[tf]
+	if tf == nil || file == nil {
+		return nil, nil, nil
+	}
+	start, end := decl.Pos(), decl.End()
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Doc != nil {
+			start = d.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if d.Doc != nil {
+			start = d.Doc.Pos()
+		}
+	}
+	endLine := tf.Line(end)
+
+	// Free-floating comments start below the line the previous
+	// declaration (or the package clause) ends on
+	after := file.Name.End()
+	for _, d := range file.Decls {
+		if d.End() <= decl.Pos() && d.End() > after {
+			after = d.End()
+		}
+	}
+	afterLine := tf.Line(after)
+
+	for _, c := range file.Comments {
+		switch {
+		case c.Pos() >= end && tf.Line(c.Pos()) == endLine:
+			trailing = c
+		case c.Pos() >= start && c.End() <= end:
+			within = append(within, c)
+		case c.End() < start && c.Pos() > after && tf.Line(c.Pos()) > afterLine:
+			floating = append(floating, c)
+		}
+	}
+	return floating, within, trailing
+}
+
+// specComment returns the line comment of decl's only spec when decl
+// has no parentheses: the printer prints that one itself.
+func specComment(decl ast.Decl) *ast.CommentGroup {
+	d, ok := decl.(*ast.GenDecl)
+	if !ok || d.Lparen.IsValid() || len(d.Specs) != 1 {
+		return nil
+	}
+	switch s := d.Specs[0].(type) {
+	case *ast.ValueSpec:
+		return s.Comment
+	case *ast.TypeSpec:
+		return s.Comment
+	case *ast.ImportSpec:
+		return s.Comment
+	}
+	return nil
+}
+
+// writeDoc writes the package comment, which belongs to no declaration,
+// to its own base_doc.go, unless the file carrying it is kept intact.
+// With Files it goes above the first of those instead, which
+// renderBucket writes with g.docHere.
+func (g *Generator) writeDoc(base string, pkg *inputPackage) error {
+	filename := base + "_doc.go"
+	for _, file := range pkg.Files {
+		if file.Doc == nil || strings.TrimSpace(file.Doc.Text()) == "" || len(splitHazards(file)) > 0 {
+			continue
+		}
+		var doc strings.Builder
+		for _, c := range file.Doc.List {
+			// Build constraints are the variants' business, see fileHeader
+			if !constraint.IsGoBuild(c.Text) && !constraint.IsPlusBuild(c.Text) {
+				doc.WriteString(c.Text + "\n")
+			}
+		}
+		if g.Files > 0 {
+			g.packageDoc = doc.String()
+			return nil
+		}
+		var buf bytes.Buffer
+		if g.wantsBanner(filename) {
+			buf.WriteString(g.banner + "\n\n")
+		}
+		fmt.Fprintf(&buf, "%spackage %s\n", doc.String(), g.PackageName)
+		src, err := format.Source(buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		if err := g.claim(filename); err != nil {
+			return err
+		}
+		return g.emit(filename, src)
+	}
+	return nil
+}
+
+// 3. DEPENDENCY MANAGEMENT
+// ---------------------------------------------------------
+
+func (g *Generator) setupThirdParty() error {
+	// 1. Vendor, outside the input module so read-only checkouts work
+	work, err := os.MkdirTemp("", "bradley-work-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(work)
+	g.vendorDir = filepath.Join(work, "vendor")
+	if err := g.vendor(); err != nil {
+		return err
+	}
+
+	// 2. Identify modules from modules.txt
+	f, err := os.Open(filepath.Join(g.vendorDir, "modules.txt"))
+	if os.IsNotExist(err) {
+		return nil // No dependencies to shade
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var mods, pkgs []string
+	owner := map[string]string{}      // package -> module
+	goVersions := map[string]string{} // module -> its go directive
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "# ") {
+			fields := strings.Fields(line)
+			if slices.Contains(mods, fields[1]) {
+				continue // Trailing "# mod => dir" replacement records
+			}
+			mods = append(mods, fields[1])
+			if len(fields) > 2 && fields[2] != "=>" {
+				g.modules = append(g.modules, LockedModule{Path: fields[1], Version: fields[2]})
+			}
+		} else if strings.HasPrefix(line, "## ") && len(mods) > 0 {
+			if v := goAnnotation(line); v != "" {
+				goVersions[mods[len(mods)-1]] = v
+			}
+		} else if line != "" && !strings.HasPrefix(line, "#") && len(mods) > 0 {
+			pkgs = append(pkgs, line)
+			owner[line] = mods[len(mods)-1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if err := g.checkGoVersions(goVersions); err != nil {
+		return err
+	}
+	if g.CheckUpstream {
+		g.checkUpstream()
+	}
+
+	g.planLayout(mods, pkgs, owner)
+	if err := g.analyzeVendor(pkgs, owner); err != nil {
+		return err
+	}
+
+	licenses := map[string]license{}
+	for _, mod := range mods {
+		licenses[mod] = detectLicense(diskPath(g.vendorDir, mod))
+	}
+	if err := g.checkLicenses(licenses); err != nil {
+		return err
+	}
+
+	// 3. Prune trees no library build needs
+	if err := g.pruneVendor(pkgs); err != nil {
+		return err
+	}
+
+	// 4. Move (or link) each module into third_party
+	if g.Link {
+		if err := g.linkModules(mods); err != nil {
+			return err
+		}
+	} else {
+		for _, mod := range mods {
+			oldPath := diskPath(g.vendorDir, mod)
+			newPath := diskPath(g.ThirdPartyDir, g.shadedPath(mod))
+			if _, err := os.Stat(longPath(oldPath)); err != nil {
+				continue // Moved along with the module holding it
+			}
+			if _, err := os.Stat(longPath(newPath)); err == nil && g.SharedThirdParty != "" {
+				continue // The shared directory keeps the copy it has
+			}
+			// The previous run's copy, at whatever version, makes way
+			if err := g.setAside(newPath); err != nil {
+				return err
+			}
+
+			os.MkdirAll(longPath(filepath.Dir(newPath)), 0755)
+			if err := os.Rename(longPath(oldPath), longPath(newPath)); err != nil {
+				// The scratch directory is on another device
+				if err := copyDir(longPath(oldPath), longPath(newPath)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// 5. Record where each package came from
+	if err := g.writeProvenance(owner); err != nil {
+		return err
+	}
+
+	// Listed once complete, PROVENANCE files included, for Clean
+	for _, mod := range mods {
+		g.recordCreated(diskPath(g.ThirdPartyDir, g.shadedPath(mod)))
+	}
+	return nil
+}
+
+// 4. MAIN ORCHESTRATION
+// ---------------------------------------------------------
+
+// GenerateFiles splits inputFile into a new module and shades its
+// dependencies into third_party.
+func GenerateFiles(inputFile string, opts Options) error {
+	return NewGenerator(inputFile, opts).generate(inputFile)
+}
+
+// Generate splits inputs, one input the way GenerateFiles does and
+// several as a batch (see generateBatch), returning the directory and
+// module path of the output.
+func Generate(inputs []string, opts Options) (dir, modulePath string, err error) {
+	var g *Generator
+	switch len(inputs) {
+	case 0:
+		return "", "", fmt.Errorf("no inputs")
+	case 1:
+		g = NewGenerator(inputs[0], opts)
+		err = g.generate(inputs[0])
+	default:
+		if g, err = newBatch(inputs, opts); err != nil {
+			return "", "", err
+		}
+		err = g.generateBatch(inputs)
+	}
+	return g.OutputDir, g.ProjectName, err
+}
+
+// generate runs the whole generation for g, see GenerateFiles.
+func (g *Generator) generate(inputFile string) (err error) {
+	release, err := g.prepare(inputFile)
+	if err != nil {
+		return err
+	}
+	defer release(&err)
+	fmt.Fprintf(progress(), "🚀 Starting generation for %s...\n", g.ProjectName)
+
+	phase("load")
+	pkg, err := g.loadInput(inputFile)
+	if err == nil {
+		err = checkInterrupt()
+	}
+	if err != nil {
+		return err
+	}
+	phase("write")
+	os.MkdirAll(g.OutputDir, 0755)
+	if err := g.writeSplit(inputFile, pkg); err != nil {
+		return err
+	}
+	return g.finish(inputFile)
+}
+
+// prepare checks the options, settles where the output goes and checks
+// it can be zipped there before anything is written. It then locks the
+// output, starts backing it up (and a shared third_party) as the run
+// writes there, see backup, and snapshots the inputs' module, returning
+// the func releasing it: that adds to the run's error any change to the
+// module (see checkUntouched), and restores the backups if the run was
+// interrupted.
+func (g *Generator) prepare(inputs ...string) (func(*error), error) {
+	inputFile := inputs[0]
+	if err := errors.Join(validateOptions(g.Options)...); err != nil {
+		return nil, err
+	}
+	if g.Overlay {
+		if err := g.overlayInput(inputFile); err != nil {
+			return nil, err
+		}
+	}
+	if g.Nested {
+		if err := g.nestInModule(inputFile); err != nil {
+			return nil, err
+		}
+	}
+	if g.Zip != "" {
+		if err := g.checkZip(); err != nil {
+			return nil, err
+		}
+	}
+	unlock, err := g.lockOutput()
+	if err != nil {
+		return nil, err
+	}
+	// What the run regenerates is backed up as it goes, so an
+	// interrupted run leaves it as it was
+	dirs := []string{g.OutputDir}
+	if g.SharedThirdParty != "" {
+		dirs = append(dirs, g.ThirdPartyDir)
+	}
+	for _, dir := range dirs {
+		b, err := backupDir(dir)
+		if err != nil {
+			unlock()
+			return nil, fmt.Errorf("backing up %s: %w", dir, err)
+		}
+		g.backups = append(g.backups, b)
+	}
+	release := func(err *error) {
+		if uerr := g.checkUntouched(); uerr != nil {
+			if *err == nil {
+				*err = uerr
+			} else {
+				*err = fmt.Errorf("%w\n%w", *err, uerr)
+			}
+		}
+		for _, b := range g.backups {
+			if Interrupted() {
+				b.restore()
+			} else {
+				b.discard()
+			}
+		}
+		g.backups = nil
+		unlock()
+	}
+	if err := g.guardModule(inputs...); err != nil {
+		release(&err)
+		return nil, err
+	}
+	return release, nil
+}
+
+// writePackage writes the package documentation, then the buckets and
+// tests of each build variant of pkg, named after base.
+func (g *Generator) writePackage(base string, pkg *inputPackage) error {
+	g.moveInput(pkg)
+	if err := g.writeDoc(base, pkg); err != nil {
+		return err
+	}
+	defer func() { g.buildLine = "" }()
+	for _, v := range g.variants(pkg) {
+		g.buildLine = v.buildLine
+		if err := g.writeVariant(base, v); err != nil {
+			return err
+		}
+		if err := g.writeTests(v.base(base), g.PackageName+"_test", collectDecls(v.xtests), g.externalTestImports(pkg, v.xtests), v.suffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSplit writes the buckets of the loaded input into OutputDir.
+func (g *Generator) writeSplit(inputFile string, pkg *inputPackage) error {
+	g.banner = packageBanner(pkg.Files)
+	if g.Overlay {
+		for _, file := range slices.Concat(pkg.Files, pkg.Tests, pkg.ExternalTests) {
+			g.splitFiles = append(g.splitFiles, g.Fset.File(file.Pos()).Name())
+		}
+	}
+
+	abs, _ := filepath.Abs(inputFile)
+	base := filepath.Base(abs)
+	if strings.HasSuffix(base, ".go") {
+		// The suffix of a single input file belongs at the end of every
+		// bucket name, which its variant takes care of
+		base, _ = platformSuffix(base)
+	}
+	if err := g.writePackage(base, pkg); err != nil {
+		return err
+	}
+	if info, err := os.Stat(inputFile); err == nil && !info.IsDir() {
+		inputFile = filepath.Dir(inputFile)
+	}
+	return g.copyFuzzCorpora(inputFile, pkg)
+}
+
+// finish turns OutputDir into a module, shades its dependencies and
+// writes the lock and report for inputs.
+func (g *Generator) finish(inputs ...string) error {
+	// Init module
+	phase("third_party")
+	// go mod init, edit and tidy write these
+	if err := g.touch(filepath.Join(g.OutputDir, "go.mod"), filepath.Join(g.OutputDir, "go.sum")); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(g.OutputDir, "go.mod")); os.IsNotExist(err) {
+		if err := runCmd(g.OutputDir, "go", "mod", "init", g.ProjectName); err != nil {
+			return fmt.Errorf("go mod init: %w", err)
+		}
+	}
+	g.created = append(g.created, "go.mod", "go.sum")
+	if g.goVersion = inputGoVersion(g.requirementsDir()); g.goVersion != "" {
+		// Target the input's Go rather than the toolchain's, see checkGoVersions
+		if err := runCmd(g.OutputDir, "go", "mod", "edit", "-go="+g.goVersion); err != nil {
+			return err
+		}
+	}
+
+	// Setup deps
+	var shared map[string]string
+	if g.SharedThirdParty != "" {
+		var err error
+		if shared, err = g.readSharedLock(); err != nil {
+			return err
+		}
+	}
+	if err := g.setupThirdParty(); err != nil {
+		return err
+	}
+	if g.separateThirdParty() {
+		if err := g.setupShared(shared); err != nil {
+			return err
+		}
+	}
+	if err := g.shadeTools(inputs[0]); err != nil {
+		return err
+	}
+	if err := g.removeStale(); err != nil {
+		return err
+	}
+	if err := checkInterrupt(); err != nil {
+		return err
+	}
+
+	// Rewrite all imports (The Shading phase)
+	phase("rewrite")
+	fmt.Fprintln(progress(), "✏️  Rewriting imports to local paths...")
+	if err := g.processDirectoryImports(g.OutputDir); err != nil {
+		return err
+	}
+	if g.SharedThirdParty != "" {
+		if err := g.processDirectoryImports(g.ThirdPartyDir); err != nil {
+			return err
+		}
+	}
+
+	if g.StripComments == "third_party" {
+		if err := g.stripThirdPartyComments(); err != nil {
+			return err
+		}
+	}
+
+	// Final Tidy
+	if err := checkInterrupt(); err != nil {
+		return err
+	}
+	phase("tidy")
+	if err := runCmd(g.OutputDir, "go", "mod", "tidy"); err != nil {
+		return fmt.Errorf("go mod tidy: %w", err)
+	}
+
+	if g.Mangle {
+		if err := g.mangleThirdParty(); err != nil {
+			return err
+		}
+	}
+
+	if err := g.summarizeDependencies(); err != nil {
+		return err
+	}
+	if g.MaxThirdPartySize > 0 {
+		if err := g.checkBudget(); err != nil {
+			return err
+		}
+	}
+
+	if len(g.VerifyPlatforms) > 0 {
+		phase("verify")
+		if err := g.verifyPlatforms(); err != nil {
+			return err
+		}
+	}
+
+	if err := checkInterrupt(); err != nil {
+		return err
+	}
+	phase("metadata")
+	if g.Index {
+		if err := g.writeIndex(); err != nil {
+			return err
+		}
+	}
+	if g.Overlay {
+		if err := g.writeOverlay(); err != nil {
+			return err
+		}
+	}
+	if err := g.writeLock(inputs...); err != nil {
+		return err
+	}
+	if err := g.writeReport(); err != nil {
+		return err
+	}
+	if g.Zip != "" {
+		if err := g.writeZip(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(progress(), "✨ Done!")
+	SendEvent(Event{Type: "done"})
+	return nil
+}
+
+// writeVariant splits the files of one build variant into buckets. Only
+// the common, unconstrained variant gets the optional layouts; platform
+// variants keep to kind buckets so their names never collide.
+func (g *Generator) writeVariant(base string, v *variant) error {
+	files, err := g.pinFiles(v.files)
+	if err != nil {
+		return err
+	}
+	tests, err := g.pinFiles(v.tests)
+	if err != nil {
+		return err
+	}
+
+	// A bucket that fails to write must fail the run, not leave a gap
+	var errs []error
+	write := func(filename, pkgName string, decls []ast.Decl, imports []*ast.ImportSpec) {
+		errs = append(errs, g.writeBucket(filename, pkgName, decls, imports))
+	}
+
+	var typeDecls, funcDecls, methodDecls, mainDecls []ast.Decl
+	allImports := collectImports(files)
+
+	decls := collectDecls(files)
+	if len(g.Subpackages) > 0 {
+		if v.label != "" {
+			return fmt.Errorf("subpackages: platform-specific files (%s) are not supported", v.label)
+		}
+		if decls, err = g.writeSubpackages(base, decls, allImports); err != nil {
+			return err
+		}
+	}
+	for _, decl := range decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			typeDecls = append(typeDecls, d)
+		case *ast.FuncDecl:
+			if g.PackageName == "main" && d.Recv == nil && d.Name.Name == "main" {
+				mainDecls = append(mainDecls, d)
+			} else if d.Recv == nil {
+				funcDecls = append(funcDecls, d)
+			} else {
+				methodDecls = append(methodDecls, d)
+			}
+		}
+	}
+
+	if v.label != "" {
+		base = v.base(base)
+		if g.Files > 0 {
+			for i, group := range g.balanceDecls(slices.Concat(typeDecls, funcDecls, methodDecls, mainDecls), g.Files) {
+				write(bucketName(base, strconv.Itoa(i+1), v.suffix), g.PackageName, group, allImports)
+			}
+		} else {
+			write(bucketName(base, "types", v.suffix), g.PackageName, typeDecls, allImports)
+			write(bucketName(base, "funcs", v.suffix), g.PackageName, funcDecls, allImports)
+			write(bucketName(base, "methods", v.suffix), g.PackageName, methodDecls, allImports)
+			write(bucketName(base, "main", v.suffix), g.PackageName, mainDecls, allImports)
+		}
+		errs = append(errs, g.writeTests(base, g.PackageName, collectDecls(tests), collectImports(tests), v.suffix))
+		return errors.Join(errs...)
+	}
+
+	// With Files, the declarations bradley adds go into the files too,
+	// and internal/helpers counts as one of them
+	n, imports := g.Files, allImports
+	if g.InternalHelpers {
+		rest, moved, forwarders, err := g.relocateHelpers(funcDecls, typeDecls)
+		if err != nil {
+			return err
+		}
+		funcDecls = rest
+		write(diskPath("internal", helpersPkg, bucketName(helpersPkg, "", v.suffix)), helpersPkg, moved, allImports)
+		imports = append([]*ast.ImportSpec{g.helpersImport()}, allImports...)
+		if n > 0 {
+			funcDecls = append(funcDecls, forwarders...)
+			if len(moved) > 0 && n > 1 {
+				n--
+			}
+		} else {
+			write(bucketName(base, "forwarders", v.suffix), g.PackageName, forwarders, imports)
+		}
+	}
+	if len(g.ExtractInterfaces) > 0 {
+		// Extract before -interface-files regroups the declarations
+		decls, err := g.extractInterfaces(g.ExtractInterfaces, typeDecls, methodDecls)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			typeDecls = append(typeDecls, decls...)
+		} else {
+			write(bucketName("interfaces", "", v.suffix), g.PackageName, decls, allImports)
+		}
+	}
+	if g.InterfaceFiles {
+		var groups []declGroup
+		typeDecls, methodDecls, groups = splitInterfaces(typeDecls, methodDecls, g.WithImpls)
+		for _, group := range groups {
+			write(interfaceFileName(base, group.name, v.suffix), g.PackageName, group.decls, allImports)
+		}
+	}
+	if n > 0 {
+		decls := slices.Concat(typeDecls, funcDecls, methodDecls, mainDecls)
+		for i, group := range g.balanceDecls(decls, n) {
+			g.docHere = i == 0 // The package comment, see writeDoc
+			write(bucketName(base, strconv.Itoa(i+1), v.suffix), g.PackageName, group, imports)
+		}
+		g.docHere = false
+		typeDecls, funcDecls, methodDecls, mainDecls = nil, nil, nil, nil
+	}
+	write(bucketName(base, "types", v.suffix), g.PackageName, typeDecls, allImports)
+	write(bucketName(base, "funcs", v.suffix), g.PackageName, funcDecls, allImports)
+	if g.MethodsByReceiver {
+		for _, group := range groupByReceiver(methodDecls) {
+			write(bucketName(base+"_"+strings.ToLower(group.name), "methods", v.suffix), g.PackageName, group.decls, allImports)
+		}
+	} else {
+		write(bucketName(base, "methods", v.suffix), g.PackageName, methodDecls, allImports)
+	}
+	write(bucketName("main", "", v.suffix), g.PackageName, mainDecls, allImports)
+
+	// Tests keep their own files so test-only declarations never leak
+	// into the package proper
+	errs = append(errs, g.writeTests(base, g.PackageName, collectDecls(tests), collectImports(tests), v.suffix))
+	return errors.Join(errs...)
+}
+
+// HELPERS
+// ---------------------------------------------------------
+
+func runCmd(dir string, name string, args ...string) error {
+	cmd := command(name, args...)
+	cmd.Dir = dir
+	return cmd.Run()
+}
+
+func cmdOutput(dir string, name string, args ...string) (string, error) {
+	cmd := command(name, args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// interfaceFileName names the file of the interface name: base_name.go,
+// or base_name_interface.go where the name would make it a kind bucket
+// (base_types.go), a test or a file for one platform only.
+func interfaceFileName(base, name, suffix string) string {
+	name = strings.ToLower(name)
+	switch {
+	case slices.Contains([]string{"types", "funcs", "methods", "forwarders", "doc", "test"}, name),
+		knownOS[name], knownArch[name], strings.Trim(name, "0123456789") == "":
+		name += "_interface"
+	}
+	return bucketName(base+"_"+name, "", suffix)
+}
+
+// bucketName joins base and kind, keeping a GOOS/GOARCH suffix last (and
+// before _test) so the toolchain's implicit filename constraint matches
+// the variant: ("fs", "funcs", "linux") -> "fs_funcs_linux.go".
+func bucketName(base, kind, suffix string) string {
+	test := ""
+	if kind == "test" || strings.HasSuffix(kind, "_test") {
+		kind, test = strings.TrimSuffix(strings.TrimSuffix(kind, "test"), "_"), "_test"
+	}
+	name := base
+	if kind != "" {
+		name += "_" + kind
+	}
+	if suffix != "" {
+		name += "_" + suffix
+	}
+	return name + test + ".go"
+}
+
+// collectDecls returns every non-import declaration of files, in order.
+func collectDecls(files []*ast.File) []ast.Decl {
+	var decls []ast.Decl
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+				continue
+			}
+			decls = append(decls, decl)
+		}
+	}
+	return decls
+}
+
+// collectImports merges the imports of files, dropping exact duplicates.
+func collectImports(files []*ast.File) []*ast.ImportSpec {
+	var specs []*ast.ImportSpec
+	seen := map[string]bool{}
+	for _, file := range files {
+		for _, imp := range file.Imports {
+			key := imp.Path.Value
+			if imp.Name != nil {
+				key = imp.Name.Name + " " + key
+			}
+			if !seen[key] {
+				seen[key] = true
+				specs = append(specs, imp)
+			}
+		}
+	}
+	return specs
+}
+
+type declGroup struct {
+	name  string
+	decls []ast.Decl
+}
+
+// groupByReceiver buckets methods by receiver base type, ordered by name.
+func groupByReceiver(methods []ast.Decl) []declGroup {
+	index := map[string]int{}
+	var groups []declGroup
+	for _, decl := range methods {
+		name := receiverName(decl.(*ast.FuncDecl))
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, declGroup{name: name})
+		}
+		groups[i].decls = append(groups[i].decls, decl)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].name < groups[j].name })
+	return groups
+}
+
+// receiverName returns T for receivers of the form T, *T, T[P] or *T[P].
+func receiverName(fn *ast.FuncDecl) string {
+	expr := fn.Recv.List[0].Type
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return "recv"
+		}
+	}
+}
+
+// moveInput records that the input package now lives at the split
+// module, in g.moved. It runs before any bucket is written: imports of
+// the input, by its external tests and by the linkname targets, are
+// rewritten from it, and shading leaves the input alone.
+func (g *Generator) moveInput(pkg *inputPackage) {
+	if pkg.ImportPath == "" {
+		return
+	}
+	if g.moved == nil {
+		g.moved = map[string]string{}
+	}
+	g.moved[pkg.ImportPath] = g.ProjectName
+}
+
+// externalTestImports points the external test package at the split
+// module, keeping the original package name as the local name so
+// qualified references in the tests still resolve.
+func (g *Generator) externalTestImports(pkg *inputPackage, files []*ast.File) []*ast.ImportSpec {
+	specs := collectImports(files)
+	for i, imp := range specs {
+		if pkg.ImportPath == "" || strings.Trim(imp.Path.Value, `"`) != pkg.ImportPath {
+			continue
+		}
+		name := imp.Name
+		if name == nil {
+			name = ast.NewIdent(pkg.Name)
+		}
+		specs[i] = &ast.ImportSpec{
+			Name: name,
+			Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(g.ProjectName)},
+		}
+	}
+	return specs
+}
+
+// commandName derives a module name for a main package from the
+// directory holding it, falling back to the file name.
+func commandName(inputFile string) string {
+	abs, err := filepath.Abs(inputFile)
+	if err == nil {
+		if info, statErr := os.Stat(abs); statErr != nil || !info.IsDir() {
+			abs = filepath.Dir(abs)
+		}
+		if dir := filepath.Base(abs); dir != "." && dir != string(filepath.Separator) {
+			return strings.ToLower(dir)
+		}
+	}
+	return strings.TrimSuffix(filepath.Base(inputFile), ".go")
+}
+
+func isThirdParty(path string) bool {
+	if path == "" {
+		return false
+	}
+	firstPart := strings.Split(path, "/")[0]
+	return strings.Contains(firstPart, ".")
+}
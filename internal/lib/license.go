@@ -0,0 +1,148 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 24. LICENSES
+// ---------------------------------------------------------
+
+// Phrases identifying the common licenses, most specific first. The GNU
+// licenses get their version from the text, see identifyLicense.
+var licenseMarkers = []struct{ id, phrase string }{
+	{"AGPL", "GNU AFFERO GENERAL PUBLIC LICENSE"},
+	{"LGPL", "GNU LESSER GENERAL PUBLIC LICENSE"},
+	{"LGPL", "GNU LIBRARY GENERAL PUBLIC LICENSE"},
+	{"GPL", "GNU GENERAL PUBLIC LICENSE"},
+	{"Apache-2.0", "Apache License"},
+	{"MPL-2.0", "Mozilla Public License"},
+	{"BSD-3-Clause", "Neither the name"},
+	{"BSD-2-Clause", "Redistributions in binary form"},
+	{"ISC", "Permission to use, copy, modify, and/or distribute"},
+	{"MIT", "Permission is hereby granted, free of charge"},
+	{"Unlicense", "This is free and unencumbered software"},
+}
+
+// license is what a module root says about its license: the SPDX id if
+// the text was recognized, and the file it came from.
+type license struct {
+	id, file string
+}
+
+// isLicenseFile reports whether a module-root file name holds a license.
+func isLicenseFile(name string) bool {
+	upper := strings.ToUpper(name)
+	return strings.HasPrefix(upper, "LICENSE") || strings.HasPrefix(upper, "LICENCE") || strings.HasPrefix(upper, "COPYING")
+}
+
+// identifyLicense matches license text against licenseMarkers.
+func identifyLicense(text string) string {
+	for _, m := range licenseMarkers {
+		if !strings.Contains(text, m.phrase) {
+			continue
+		}
+		switch m.id {
+		case "AGPL":
+			return "AGPL-3.0"
+		case "LGPL":
+			if strings.Contains(text, "Version 3") {
+				return "LGPL-3.0"
+			}
+			return "LGPL-2.1"
+		case "GPL":
+			if strings.Contains(text, "Version 3") {
+				return "GPL-3.0"
+			}
+			return "GPL-2.0"
+		}
+		return m.id
+	}
+	return ""
+}
+
+// detectLicense reads the license file at a module root.
+func detectLicense(root string) license {
+	entries, err := os.ReadDir(longPath(root))
+	if err != nil {
+		return license{}
+	}
+	for _, e := range entries {
+		if e.IsDir() || !isLicenseFile(e.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(longPath(filepath.Join(root, e.Name())))
+		if err != nil {
+			continue
+		}
+		return license{id: identifyLicense(string(data)), file: e.Name()}
+	}
+	return license{}
+}
+
+func describeLicense(l license) string {
+	switch {
+	case l.file == "":
+		return "unknown"
+	case l.id == "":
+		return "see " + l.file
+	}
+	return fmt.Sprintf("%s (%s)", l.id, l.file)
+}
+
+// licenseViolation says why a module's license breaks the policy, or ""
+// when it complies. Policy entries match an SPDX id exactly or as a
+// prefix ending in "-": "GPL" covers GPL-2.0 and GPL-3.0 but not LGPL.
+func (g *Generator) licenseViolation(l license) string {
+	matches := func(list []string) bool {
+		for _, entry := range list {
+			if l.id == entry || strings.HasPrefix(l.id, entry+"-") {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case l.id != "" && matches(g.DenyLicenses):
+		return l.id + " is denied"
+	case len(g.AllowLicenses) > 0 && l.id == "":
+		return "license " + describeLicense(l) + " is unrecognized and not allowed"
+	case len(g.AllowLicenses) > 0 && !matches(g.AllowLicenses):
+		return l.id + " is not allowed"
+	}
+	return ""
+}
+
+// checkLicenses applies the license policy to the modules about to be
+// shaded, given their licenses. Violations are reported and, unless
+// LicensePolicy is "warn", fail the run before anything is moved.
+func (g *Generator) checkLicenses(licenses map[string]license) error {
+	if len(g.AllowLicenses) == 0 && len(g.DenyLicenses) == 0 {
+		return nil
+	}
+	mods := make([]string, 0, len(licenses))
+	for mod := range licenses {
+		mods = append(mods, mod)
+	}
+	sort.Strings(mods)
+	var violations []string
+	for _, mod := range mods {
+		if why := g.licenseViolation(licenses[mod]); why != "" {
+			violations = append(violations, fmt.Sprintf("%s: %s", mod, why))
+		}
+	}
+	g.report.LicenseViolations = violations
+	if len(violations) == 0 {
+		return nil
+	}
+	if g.LicensePolicy == "warn" {
+		for _, v := range violations {
+			warnf("License policy: %s", v)
+		}
+		return nil
+	}
+	return fmt.Errorf("license policy violated:\n  %s", strings.Join(violations, "\n  "))
+}
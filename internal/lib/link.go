@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"fmt"
+	"go/format"
+	"go/parser"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 9. LINK MODE
+// ---------------------------------------------------------
+
+// linkModules mirrors the vendor tree into third_party with symlinks to
+// the corresponding files in the module cache, then dry-runs the import
+// rewrite over them. Files are linked one by one: linking whole module
+// directories would bring their go.mod along and cut them out of the
+// output module.
+func (g *Generator) linkModules(mods []string) error {
+	if len(mods) == 0 {
+		return nil
+	}
+	modfile, cleanup, err := g.scratchModFlag()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	dirs, err := moduleDirs(g.moduleDir, modfile, mods)
+	if err != nil {
+		return err
+	}
+
+	var linked []string
+	err = filepath.Walk(g.vendorDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || path == filepath.Join(g.vendorDir, "modules.txt") {
+			return err
+		}
+		rel := slashPath(strings.TrimPrefix(path, g.vendorDir+string(filepath.Separator)))
+		mod := owningModule(rel, mods)
+		dir, ok := dirs[mod]
+		if mod == "" || !ok {
+			return fmt.Errorf("no module directory for vendored %s", rel)
+		}
+		target := diskPath(dir, strings.TrimPrefix(rel, mod))
+		newPath := diskPath(g.ThirdPartyDir, g.shadedPath(rel))
+		if err := g.touch(newPath); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(longPath(filepath.Dir(newPath)), 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink(target, longPath(newPath)); err != nil {
+			return err
+		}
+		if strings.HasSuffix(rel, ".go") {
+			linked = append(linked, target)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	n, err := g.validateLinkedRewrites(linked)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(progress(), "🔗 Linked %d modules; %d files would have their imports rewritten\n", len(mods), n)
+	return nil
+}
+
+// moduleDirs maps each of mods, dependencies of the module at root, to
+// its directory, which for most modules lies in the read-only module
+// cache. modfile is the -modfile flag of a scratch go.mod, for what
+// -mod=mod writes.
+func moduleDirs(root, modfile string, mods []string) (map[string]string, error) {
+	args := append([]string{"list", "-mod=mod", modfile, "-m", "-f", "{{.Path}}\t{{.Dir}}"}, mods...)
+	out, err := cmdOutput(root, "go", args...)
+	if err != nil {
+		return nil, fmt.Errorf("go list -m: %w", err)
+	}
+	dirs := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if mod, dir, ok := strings.Cut(line, "\t"); ok && dir != "" {
+			dirs[mod] = dir
+		}
+	}
+	return dirs, nil
+}
+
+// owningModule picks the longest module path rel lies under, so files of
+// a nested module are not attributed to its parent.
+func owningModule(rel string, mods []string) string {
+	best := ""
+	for _, mod := range mods {
+		if hasPathPrefix(rel, mod) && len(mod) > len(best) {
+			best = mod
+		}
+	}
+	return best
+}
+
+// validateLinkedRewrites runs the import rewrite over linked files
+// without writing, so link mode still exercises the shading logic. It
+// returns the number of files that would change.
+func (g *Generator) validateLinkedRewrites(files []string) (int, error) {
+	changed := 0
+	for _, path := range files {
+		file, err := parser.ParseFile(g.Fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return changed, err
+		}
+		if g.rewriteImportsInFile(file) {
+			changed++
+			if err := format.Node(io.Discard, g.Fset, file); err != nil {
+				return changed, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	return changed, nil
+}
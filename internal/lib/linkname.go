@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// 22. LINKNAME TARGETS
+// ---------------------------------------------------------
+
+// rewriteLinknames follows shading in //go:linkname directives: a target
+// in a shaded package, or in the input package, is renamed to where that
+// package now lives. Targets in third-party packages that were not shaded,
+// and bodyless "push" directives in shaded code that other packages look
+// up by its original path, cannot be fixed here and are reported.
+func (g *Generator) rewriteLinknames(file *ast.File, name string, shaded bool) bool {
+	changed := false
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			if !strings.HasPrefix(c.Text, "//go:linkname ") {
+				continue
+			}
+			line := g.Fset.Position(c.Pos()).Line
+			fields := strings.Fields(c.Text)
+			if len(fields) == 2 {
+				if shaded {
+					g.report.LinknameWarnings = append(g.report.LinknameWarnings, fmt.Sprintf(
+						"%s:%d: %s is provided under the package's original path, which shading changes", name, line, fields[1]))
+				}
+				continue
+			}
+			if len(fields) != 3 {
+				continue
+			}
+			pkg, sym := splitLinkname(fields[2])
+			var moved string
+			switch {
+			case g.moved[pkg] != "":
+				moved = g.moved[pkg]
+			case g.isShaded(pkg):
+				moved = importPath(g.ImportPrefix, g.shadedPath(pkg))
+			case isThirdParty(pkg) && !hasPathPrefix(pkg, g.ImportPrefix) && !hasPathPrefix(pkg, g.ProjectName):
+				g.report.LinknameWarnings = append(g.report.LinknameWarnings, fmt.Sprintf(
+					"%s:%d: target %s is in no package of the generated module", name, line, fields[2]))
+				continue
+			default:
+				continue
+			}
+			from := c.Text
+			c.Text = fmt.Sprintf("//go:linkname %s %s%s", fields[1], moved, sym)
+			g.report.LinknameRewrites = append(g.report.LinknameRewrites, Rewrite{File: name, Line: line, From: from, To: c.Text})
+			changed = true
+		}
+	}
+	return changed
+}
+
+// splitLinkname splits a linkname target into its package path and the
+// symbol that follows it, dot included: "golang.org/x/a.(*T).m" ->
+// ("golang.org/x/a", ".(*T).m").
+func splitLinkname(target string) (pkg, sym string) {
+	slash := strings.LastIndex(target, "/")
+	dot := strings.Index(target[slash+1:], ".")
+	if dot < 0 {
+		return target, ""
+	}
+	return target[:slash+1+dot], target[slash+1+dot:]
+}
+
+// isShaded reports whether pkg belongs to a module shaded in this run.
+func (g *Generator) isShaded(pkg string) bool {
+	for mod := range g.layout {
+		if hasPathPrefix(pkg, mod) {
+			return true
+		}
+	}
+	return false
+}
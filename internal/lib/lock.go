@@ -0,0 +1,146 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+// LockFile is written into OutputDir after every successful run.
+const LockFile = "bradley.lock"
+
+type Lock struct {
+	Schema  int            `json:"schema"`
+	Tool    BuildInfo      `json:"tool"`
+	Module  string         `json:"module"`
+	Input   string         `json:"input"`
+	Inputs  []string       `json:"inputs,omitempty"` // every input of a batch, see generateBatch
+	Modules []LockedModule `json:"modules"`
+
+	// Files lists what the run created in the output, relative to it,
+	// file by file. It is what "bradley clean" removes, and what the next
+	// run removes of what it does not write again, see removeStale.
+	Files []string `json:"files,omitempty"`
+
+	// Published lists the versions "bradley publish" has released,
+	// carried over when the module is regenerated.
+	Published []Publication `json:"published,omitempty"`
+}
+
+type LockedModule struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+func (g *Generator) writeLock(inputs ...string) error {
+	lock := Lock{
+		Schema:  LockSchemaVersion,
+		Tool:    ReadBuildInfo(),
+		Module:  g.ProjectName,
+		Input:   slashPath(inputs[0]),
+		Modules: g.modules,
+	}
+	if len(inputs) > 1 {
+		for _, input := range inputs {
+			lock.Inputs = append(lock.Inputs, slashPath(input))
+		}
+	}
+	if g.memory == nil {
+		var prev Lock
+		if data, err := os.ReadFile(filepath.Join(g.OutputDir, LockFile)); err == nil && json.Unmarshal(data, &prev) == nil {
+			lock.Published = prev.Published
+			g.reportChanges(prev.Modules, lock.Modules)
+		}
+	}
+	lock.Files = slices.Compact(slices.Sorted(slices.Values(g.created)))
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	return g.emit(LockFile, append(data, '\n'))
+}
+
+// removeStale deletes the files the previous run's lock lists that this
+// run has not written, once everything but the metadata is written:
+// buckets an earlier choice of options produced (base_methods.go before
+// ByReceiver) would otherwise stay beside their replacements and break
+// the build. The metadata files are written again after it.
+func (g *Generator) removeStale() error {
+	data, err := os.ReadFile(filepath.Join(g.OutputDir, LockFile))
+	if err != nil {
+		return nil // A first run
+	}
+	var prev Lock
+	if err := json.Unmarshal(data, &prev); err != nil {
+		return fmt.Errorf("%s: %w", LockFile, err)
+	}
+	written := map[string]bool{}
+	for _, name := range g.created {
+		written[name] = true
+	}
+	var stale []string
+	for _, name := range prev.Files {
+		if !written[name] && isLocalSlash(name) {
+			stale = append(stale, name)
+		}
+	}
+	for _, name := range stale {
+		if err := g.touch(diskPath(g.OutputDir, name)); err != nil {
+			return err
+		}
+	}
+	if len(stale) > 0 {
+		fmt.Fprintf(progress(), "🧹 Removing %d files the previous run wrote and this one does not\n", len(stale))
+	}
+	_, err = removeFiles(g.OutputDir, stale)
+	return err
+}
+
+// ModuleChange is a shaded module added (Old empty), removed (New empty)
+// or moved to another version since the previous run.
+type ModuleChange struct {
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// reportChanges compares the modules of the previous lock with this
+// run's, printing the difference as a summary for the regeneration
+// commit and keeping it in the report.
+func (g *Generator) reportChanges(prev, cur []LockedModule) {
+	versions := map[string]string{}
+	for _, m := range prev {
+		versions[m.Path] = m.Version
+	}
+	var changes []ModuleChange
+	for _, m := range cur {
+		if old, ok := versions[m.Path]; !ok || old != m.Version {
+			changes = append(changes, ModuleChange{Path: m.Path, Old: old, New: m.Version})
+		}
+		delete(versions, m.Path)
+	}
+	for path, old := range versions {
+		changes = append(changes, ModuleChange{Path: path, Old: old})
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(progress(), "📋 third_party unchanged since the last run")
+		return
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	g.report.Changes = changes
+
+	fmt.Fprintln(progress(), "📋 third_party changes since the last run:")
+	for _, c := range changes {
+		switch {
+		case c.Old == "":
+			fmt.Fprintf(progress(), "  + %s %s\n", c.Path, c.New)
+		case c.New == "":
+			fmt.Fprintf(progress(), "  - %s %s\n", c.Path, c.Old)
+		default:
+			fmt.Fprintf(progress(), "  ~ %s %s => %s\n", c.Path, c.Old, c.New)
+		}
+	}
+}
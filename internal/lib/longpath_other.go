@@ -0,0 +1,13 @@
+//go:build !windows
+
+package lib
+
+// longPath and longPathRoot are no-ops where paths have no length limit
+// worth working around.
+func longPath(p string) string {
+	return p
+}
+
+func longPathRoot(p string) string {
+	return p
+}
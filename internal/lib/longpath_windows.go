@@ -0,0 +1,36 @@
+package lib
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath leaves room below MAX_PATH (260) for the 8.3 names some APIs
+// append to directory paths.
+const maxPath = 248
+
+// longPath rewrites long paths into the \\?\ form so deep shaded trees
+// such as third_party/github.com/org/name/v2/internal/... stay usable.
+// The os package only does this itself for absolute paths.
+func longPath(p string) string {
+	if len(p) < maxPath {
+		return p
+	}
+	return longPathRoot(p)
+}
+
+// longPathRoot always uses the \\?\ form, for the root of a walk whose
+// descendants may grow past the limit even when the root does not.
+func longPathRoot(p string) string {
+	if strings.HasPrefix(p, `\\?\`) {
+		return p
+	}
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return p
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,195 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// 14. MANGLING
+// ---------------------------------------------------------
+
+// mangleThirdParty renames the unexported package-level identifiers of
+// every shaded package, drops comments other than license headers and
+// directives, and squeezes out blank lines, so the shaded code no longer
+// carries its original names or layout. Packages whose names may be
+// referenced from outside Go source (assembly, cgo, //go:linkname) are
+// left alone.
+func (g *Generator) mangleThirdParty() error {
+	if g.Link {
+		warnf("Not mangling linked modules: their files live in the module cache")
+		return nil
+	}
+	dir, pattern := g.OutputDir, "./third_party/..."
+	if g.separateThirdParty() {
+		dir, pattern = g.ThirdPartyDir, "./..."
+	}
+	cfg := &packages.Config{
+		Mode: loadMode,
+		Dir:  dir,
+		Fset: token.NewFileSet(),
+	}
+	pkgs, err := packages.Load(cfg, pattern)
+	if err != nil {
+		return fmt.Errorf("loading third_party: %w", err)
+	}
+
+	renamed, touched := 0, 0
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			warnf("Not mangling %s: %v", pkg.PkgPath, pkg.Errors[0])
+			continue
+		}
+		if reason := mangleHazard(pkg); reason != "" {
+			warnf("Not mangling %s (%s)", pkg.PkgPath, reason)
+			continue
+		}
+		n := mangleNames(pkg)
+		for i, file := range pkg.Syntax {
+			src, err := strippedSource(cfg.Fset, file)
+			if err != nil {
+				return fmt.Errorf("%s: %w", pkg.CompiledGoFiles[i], err)
+			}
+			if err := g.touch(pkg.CompiledGoFiles[i]); err != nil {
+				return err
+			}
+			if err := os.WriteFile(pkg.CompiledGoFiles[i], src, 0644); err != nil {
+				return err
+			}
+		}
+		renamed += n
+		touched++
+	}
+	fmt.Fprintf(progress(), "🔀 Mangled %d identifiers in %d packages\n", renamed, touched)
+	return nil
+}
+
+// mangleHazard names the reason a package's unexported names may be
+// bound from outside the Go source loaded for this platform.
+func mangleHazard(pkg *packages.Package) string {
+	if len(pkg.OtherFiles) > 0 {
+		return "non-Go sources"
+	}
+	if len(pkg.CompiledGoFiles) != len(pkg.GoFiles) {
+		return "cgo"
+	}
+	if len(pkg.IgnoredFiles) > 0 {
+		// Files of other platforms or build tags use the same names, but
+		// were not type-checked and would keep the old ones
+		return "files excluded by build constraints"
+	}
+	for _, file := range pkg.Syntax {
+		if reasons := splitHazards(file); len(reasons) > 0 {
+			return strings.Join(reasons, ", ")
+		}
+	}
+	return ""
+}
+
+// mangleNames renames the unexported package-level consts, vars, funcs
+// and types of pkg and reports how many it renamed. Types used as
+// embedded fields keep their names, which double as field names.
+func mangleNames(pkg *packages.Package) int {
+	embedded := map[types.Object]bool{}
+	for _, obj := range pkg.TypesInfo.Defs {
+		if v, ok := obj.(*types.Var); ok && v.Embedded() {
+			t := v.Type()
+			if p, ok := t.(*types.Pointer); ok {
+				t = p.Elem()
+			}
+			if named, ok := t.(*types.Named); ok {
+				embedded[named.Obj()] = true
+			}
+		}
+	}
+
+	used := map[string]bool{}
+	for _, file := range pkg.Syntax {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+			return true
+		})
+	}
+
+	scope := pkg.Types.Scope()
+	names := map[types.Object]string{}
+	next := 0
+	for _, name := range scope.Names() { // Sorted, so output is stable
+		obj := scope.Lookup(name)
+		if obj.Exported() || name == "_" || name == "init" || name == "main" || embedded[obj] {
+			continue
+		}
+		var mangled string
+		for {
+			mangled = "z" + strconv.FormatInt(int64(next), 36)
+			next++
+			if !used[mangled] && types.Universe.Lookup(mangled) == nil {
+				break
+			}
+		}
+		names[obj] = mangled
+	}
+
+	for id, obj := range pkg.TypesInfo.Defs {
+		if name, ok := names[obj]; ok {
+			id.Name = name
+		}
+	}
+	for id, obj := range pkg.TypesInfo.Uses {
+		if name, ok := names[obj]; ok {
+			id.Name = name
+		}
+	}
+	return len(names)
+}
+
+// strippedSource prints file without comments (see stripComments) and
+// without blank lines outside raw string literals.
+func strippedSource(fset *token.FileSet, file *ast.File) ([]byte, error) {
+	stripComments(file)
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return squeezeBlankLines(buf.Bytes())
+}
+
+// squeezeBlankLines drops empty lines after the package clause, except
+// inside raw strings where they are part of a value. Those above it keep
+// build constraints apart from the package doc.
+func squeezeBlankLines(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	literal := map[int]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			for line := fset.Position(lit.Pos()).Line + 1; line <= fset.Position(lit.End()).Line; line++ {
+				literal[line] = true
+			}
+		}
+		return true
+	})
+
+	var out bytes.Buffer
+	for i, line := range strings.SplitAfter(string(src), "\n") {
+		if strings.TrimSpace(line) == "" && !literal[i+1] && i+1 > fset.Position(file.Package).Line {
+			continue
+		}
+		out.WriteString(line)
+	}
+	return format.Source(out.Bytes())
+}
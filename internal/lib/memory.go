@@ -0,0 +1,413 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// 19. IN-MEMORY GENERATION
+// ---------------------------------------------------------
+
+// Source is a module held in memory, its files keyed by slash-separated
+// path relative to the module root.
+type Source struct {
+	Path    string // module path
+	Version string // version, for dependencies
+	Files   map[string][]byte
+}
+
+// GenerateInMemory splits the package at the root of src and shades the
+// packages it needs from deps, returning the generated module's files
+// keyed by slash-separated path. It never touches the disk or runs the
+// go command, so there is no type information: imports are kept by name,
+// as the syntax-only fallback does. Options that need the disk, the go
+// command or the network (Link, SharedThirdParty, Mangle,
+// MaxThirdPartySize, VerifyPlatforms, Nested, Zip, Tools, CheckUpstream,
+// DepsDev, Overlay) are rejected, and shaded packages get no PROVENANCE.
+func GenerateInMemory(src Source, deps []Source, opts Options) (map[string][]byte, error) {
+	if err := errors.Join(validateOptions(opts)...); err != nil {
+		return nil, err
+	}
+	switch {
+	case opts.Link, opts.SharedThirdParty != "", opts.Mangle, opts.MaxThirdPartySize > 0, len(opts.VerifyPlatforms) > 0, opts.Nested, opts.Zip != "", opts.Tools, opts.CheckUpstream, opts.DepsDev, opts.Overlay:
+		return nil, fmt.Errorf("in-memory generation supports neither linking, sharing, mangling, size budgets, platform verification, nesting, zips, tools, upstream checks, deps.dev lookups nor overlays")
+	}
+
+	fset := token.NewFileSet()
+	var names []string
+	for name := range src.Files {
+		if strings.HasSuffix(name, ".go") && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var files []*ast.File
+	counts := map[string]int{}
+	for _, name := range names {
+		if err := checkSource(name, src.Files[name]); err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(fset, name, src.Files[name], parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		if !strings.HasSuffix(name, "_test.go") && !isIgnored(file) {
+			counts[file.Name.Name]++
+		}
+	}
+	pkgName := ""
+	for name, n := range counts {
+		if n > counts[pkgName] || (n == counts[pkgName] && name < pkgName) {
+			pkgName = name
+		}
+	}
+	if pkgName == "" {
+		return nil, fmt.Errorf("%s: no Go package at the module root", src.Path)
+	}
+
+	base := path.Base(src.Path)
+	if prefix, _, ok := module.SplitPathVersion(src.Path); ok && prefix != "" {
+		base = path.Base(prefix)
+	}
+	g := newGenerator(pkgName, strings.ToLower(base), opts)
+	g.Fset = fset
+	g.OutputDir = ""
+	g.memory = map[string][]byte{}
+
+	pkg := &inputPackage{Name: pkgName, ImportPath: src.Path}
+	for i, file := range files {
+		g.trackComments(file)
+		pkg.add(names[i], file)
+	}
+	if len(pkg.Files) == 0 {
+		return nil, fmt.Errorf("%s: no buildable files for package %s", src.Path, pkgName)
+	}
+	g.banner = packageBanner(pkg.Files)
+	if err := g.writePackage(base, pkg); err != nil {
+		return nil, err
+	}
+	for _, fuzz := range fuzzTests(pkg) {
+		for name, data := range src.Files {
+			if strings.HasPrefix(name, "testdata/fuzz/"+fuzz+"/") {
+				g.emit(name, data)
+			}
+		}
+	}
+
+	if data, ok := src.Files["go.mod"]; ok {
+		if mf, err := modfile.ParseLax("go.mod", data, nil); err == nil && mf.Go != nil {
+			g.goVersion = mf.Go.Version
+		}
+	}
+	goLine := ""
+	if g.goVersion != "" {
+		goLine = fmt.Sprintf("\ngo %s\n", g.goVersion)
+	}
+	gomod := fmt.Sprintf("module %s\n", g.ProjectName) + goLine
+	if g.Namespace != "" {
+		// third_party is the namespace's module, see Options.Namespace
+		g.emit("third_party/go.mod", []byte(fmt.Sprintf("module %s\n", g.Namespace)+goLine))
+		gomod += fmt.Sprintf("\nrequire %s v0.0.0\n\nreplace %[1]s => ./third_party\n", g.Namespace)
+	}
+	g.emit("go.mod", []byte(gomod))
+
+	var roots []*ast.File
+	roots = append(append(append(roots, pkg.Files...), pkg.Tests...), pkg.ExternalTests...)
+	if err := g.shadeInMemory(roots, deps); err != nil {
+		return nil, err
+	}
+	if err := g.summarizeDependencies(); err != nil {
+		return nil, err
+	}
+	if g.Index {
+		if err := g.writeIndex(); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.writeLock(src.Path); err != nil {
+		return nil, err
+	}
+	if err := g.writeReport(); err != nil {
+		return nil, err
+	}
+	return g.memory, nil
+}
+
+// memPackage is a dependency package found among in-memory sources.
+type memPackage struct {
+	mod   *Source
+	files []string // module-relative file names, sorted
+}
+
+// shadeInMemory copies the dependency packages the roots import,
+// transitively, into third_party and rewrites every import pointing at
+// them. Like go mod vendor it takes each package's non-test files plus
+// the license files at each module root.
+func (g *Generator) shadeInMemory(roots []*ast.File, deps []Source) error {
+	index := map[string]*memPackage{}
+	for i := range deps {
+		dep := &deps[i]
+		for name := range dep.Files {
+			if strings.HasSuffix(name, "_test.go") || name == "go.mod" || name == "go.sum" {
+				continue
+			}
+			dir := path.Dir(name)
+			pkgPath := dep.Path
+			if dir != "." {
+				pkgPath = importPath(dep.Path, dir)
+			}
+			p := index[pkgPath]
+			if p != nil && p.mod != dep {
+				if len(p.mod.Path) > len(dep.Path) {
+					continue // Owned by a nested module
+				}
+				p = nil
+			}
+			if p == nil {
+				p = &memPackage{mod: dep}
+				index[pkgPath] = p
+			}
+			p.files = append(p.files, name)
+		}
+	}
+
+	needed := map[string]bool{}
+	var queue []string
+	visit := func(file *ast.File) error {
+		for _, imp := range file.Imports {
+			p, _ := strconv.Unquote(imp.Path.Value)
+			if _, ok := g.moved[p]; ok || needed[p] {
+				continue // The input itself, imported by external tests
+			}
+			if _, ok := index[p]; ok {
+				needed[p] = true
+				queue = append(queue, p)
+			} else if isThirdParty(p) {
+				return fmt.Errorf("no source for imported package %s", p)
+			}
+		}
+		return nil
+	}
+	for _, file := range roots {
+		if err := visit(file); err != nil {
+			return err
+		}
+	}
+	parsed := map[string]*ast.File{}
+	for len(queue) > 0 {
+		pkgPath := queue[0]
+		queue = queue[1:]
+		p := index[pkgPath]
+		sort.Strings(p.files)
+		for _, name := range p.files {
+			if !strings.HasSuffix(name, ".go") {
+				continue
+			}
+			file, err := parser.ParseFile(g.Fset, p.mod.Path+"/"+name, p.mod.Files[name], parser.ParseComments)
+			if err != nil {
+				return err
+			}
+			if isIgnored(file) {
+				continue
+			}
+			parsed[pkgPath+"/"+path.Base(name)] = file
+			if err := visit(file); err != nil {
+				return err
+			}
+		}
+	}
+
+	var mods, pkgs []string
+	owner := map[string]string{}
+	for pkgPath := range needed {
+		pkgs = append(pkgs, pkgPath)
+		owner[pkgPath] = index[pkgPath].mod.Path
+	}
+	sort.Strings(pkgs)
+	for _, dep := range deps {
+		for _, pkgPath := range pkgs {
+			if owner[pkgPath] == dep.Path {
+				mods = append(mods, dep.Path)
+				g.modules = append(g.modules, LockedModule{Path: dep.Path, Version: dep.Version})
+				break
+			}
+		}
+	}
+	goVersions := map[string]string{}
+	for _, dep := range deps {
+		if data, ok := dep.Files["go.mod"]; ok && slices.Contains(mods, dep.Path) {
+			if mf, err := modfile.ParseLax("go.mod", data, nil); err == nil && mf.Go != nil {
+				goVersions[dep.Path] = mf.Go.Version
+			}
+		}
+	}
+	if err := g.checkGoVersions(goVersions); err != nil {
+		return err
+	}
+
+	g.planLayout(mods, pkgs, owner)
+	licenses := map[string]license{}
+	for _, dep := range deps {
+		if !slices.Contains(mods, dep.Path) {
+			continue
+		}
+		var names []string
+		for name := range dep.Files {
+			if !strings.Contains(name, "/") && isLicenseFile(name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		l := license{}
+		if len(names) > 0 {
+			l = license{id: identifyLicense(string(dep.Files[names[0]])), file: names[0]}
+		}
+		licenses[dep.Path] = l
+	}
+	if err := g.checkLicenses(licenses); err != nil {
+		return err
+	}
+	for _, pkgPath := range pkgs {
+		var files []*ast.File
+		for name, file := range parsed {
+			if path.Dir(name) == pkgPath {
+				files = append(files, file)
+			}
+		}
+		g.recordPathHazards(pkgPath, owner[pkgPath], files)
+		g.recordLowLevel(pkgPath, files, index[pkgPath].files)
+	}
+
+	for _, pkgPath := range pkgs {
+		p := index[pkgPath]
+		for _, name := range p.files {
+			if !strings.HasSuffix(name, ".go") {
+				g.emit(path.Join("third_party", g.shadedPath(pkgPath+"/"+path.Base(name))), p.mod.Files[name])
+			}
+		}
+	}
+	for _, mod := range mods {
+		for i := range deps {
+			if deps[i].Path != mod {
+				continue
+			}
+			for name, data := range deps[i].Files {
+				if !strings.Contains(name, "/") && isLicenseFile(name) {
+					g.emit(path.Join("third_party", g.shadedPath(mod+"/"+name)), data)
+				}
+			}
+		}
+	}
+
+	// Rewrite the shaded sources, then the buckets pointing at them
+	for name, file := range parsed {
+		g.rewriteFile(file, path.Join("third_party", g.shadedPath(name)))
+		if g.StripComments == "third_party" {
+			stripComments(file)
+		}
+		var buf bytes.Buffer
+		if err := format.Node(&buf, g.Fset, file); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		g.emit(path.Join("third_party", g.shadedPath(name)), buf.Bytes())
+	}
+	for name, data := range g.memory {
+		if !strings.HasSuffix(name, ".go") || hasPathPrefix(name, "third_party") {
+			continue
+		}
+		file, err := parser.ParseFile(g.Fset, name, data, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		if !g.rewriteFile(file, name) {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := format.Node(&buf, g.Fset, file); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		g.memory[name] = buf.Bytes()
+	}
+	return nil
+}
+
+// pruneImports drops the imports src never names, going by syntax: an
+// import's name is its alias or, failing that, its last path element
+// without a major-version suffix. Blank and dot imports stay.
+func pruneImports(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+	for _, imp := range file.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		name := guessImportName(p)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name != "_" && name != "." && !used[name] {
+			deleteImport(file, imp)
+		}
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// guessImportName is the package name an import path conventionally
+// declares: "math/rand/v2" -> "rand", "gopkg.in/yaml.v3" -> "yaml".
+func guessImportName(p string) string {
+	if prefix, _, ok := module.SplitPathVersion(p); ok && prefix != "" {
+		p = prefix
+	}
+	name := path.Base(p)
+	if i := strings.Index(name, ".v"); i > 0 {
+		name = name[:i]
+	}
+	return strings.TrimPrefix(name, "go-")
+}
+
+// deleteImport removes imp from file's declarations.
+func deleteImport(file *ast.File, imp *ast.ImportSpec) {
+	for i, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		for j, spec := range gen.Specs {
+			if spec == imp {
+				gen.Specs = append(gen.Specs[:j], gen.Specs[j+1:]...)
+				if len(gen.Specs) == 0 {
+					file.Decls = append(file.Decls[:i], file.Decls[i+1:]...)
+				}
+				return
+			}
+		}
+	}
+}
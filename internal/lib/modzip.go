@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/zip"
+)
+
+// 27. MODULE ZIP
+// ---------------------------------------------------------
+
+// zipPath is where writeZip puts the module zip: next to OutputDir,
+// since a zip inside the module would end up in itself.
+func (g *Generator) zipPath() string {
+	return filepath.Clean(g.OutputDir) + "@" + g.Zip + ".zip"
+}
+
+// checkZip rejects a Zip the proxy could not serve before anything is
+// generated. A sibling output is named mylib_split, which is no proxy
+// path; -nested gives it one beneath the input's module.
+func (g *Generator) checkZip() error {
+	if g.Link || g.separateThirdParty() {
+		return fmt.Errorf("zip: linked, shared or namespaced third_party is not part of the module")
+	}
+	if err := module.Check(g.ProjectName, g.Zip); err != nil {
+		if !g.Nested {
+			return fmt.Errorf("zip: %v (try -nested)", err)
+		}
+		return fmt.Errorf("zip: %v", err)
+	}
+	return nil
+}
+
+// writeZip packages the generated module as the zip a module proxy serves
+// for ProjectName at version Zip, with every file under the
+// ProjectName@Zip/ prefix. The module zip rules (size limits, file names,
+// no nested modules) are checked as it is written.
+func (g *Generator) writeZip() error {
+	name := g.zipPath()
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = zip.CreateFromDir(f, module.Version{Path: g.ProjectName, Version: g.Zip}, g.OutputDir)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name)
+		return fmt.Errorf("zip: %v", err)
+	}
+	fmt.Fprintf(progress(), "📦 Wrote %s\n", name)
+	SendEvent(Event{Type: "file", File: name})
+	return nil
+}
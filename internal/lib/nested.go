@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+)
+
+// 26. NESTED LAYOUT
+// ---------------------------------------------------------
+
+// nestInModule moves the output from a sibling directory to a nested
+// module at the root of the module holding input, named beneath that
+// module's path (example.com/repo/mylib_split).
+func (g *Generator) nestInModule(input string) error {
+	root, modPath, err := enclosingModule(input)
+	if err != nil {
+		return err
+	}
+	g.OutputDir = filepath.Join(root, g.OutputDir)
+	g.ProjectName = importPath(modPath, g.ProjectName)
+	if g.SharedThirdParty == "" {
+		g.ThirdPartyDir = filepath.Join(g.OutputDir, "third_party")
+	}
+	if g.SharedThirdParty == "" && g.Namespace == "" {
+		g.ImportPrefix = importPath(g.ProjectName, "third_party")
+	}
+	return nil
+}
+
+// errNoModule is the error of enclosingModule for an input outside any
+// module.
+var errNoModule = errors.New("not inside a module")
+
+// enclosingModule finds the go.mod at or above input, returning the
+// module's root directory and path.
+func enclosingModule(input string) (root, modPath string, err error) {
+	dir, err := filepath.Abs(input)
+	if err != nil {
+		return "", "", err
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			modPath := modfile.ModulePath(data)
+			if modPath == "" {
+				return "", "", fmt.Errorf("%s: no module directive", filepath.Join(dir, "go.mod"))
+			}
+			return dir, modPath, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", fmt.Errorf("%s is %w", input, errNoModule)
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 35. NETWORK
+// ---------------------------------------------------------
+
+// network paces bradley's own HTTP calls (deps.dev, proxy uploads):
+// at most Concurrency at once, no more than RateLimit per second, and
+// failed calls retried with backoff. The go command's downloads are
+// its own business.
+type network struct {
+	client   *http.Client // with a timeout for each attempt
+	sem      chan struct{}
+	interval time.Duration // between request starts; zero is unlimited
+	retries  int
+
+	mu   sync.Mutex
+	next time.Time // earliest start of the next request
+}
+
+// attemptTimeout bounds one attempt of a request, reading the response
+// included, so a stalled server costs a retry rather than the run.
+const attemptTimeout = 2 * time.Minute
+
+func newNetwork(opts Options) *network {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	n := &network{
+		client:  &http.Client{Timeout: attemptTimeout},
+		sem:     make(chan struct{}, concurrency),
+		retries: opts.Retries,
+	}
+	if n.retries == 0 {
+		n.retries = 3
+	}
+	if opts.RateLimit > 0 {
+		n.interval = time.Duration(float64(time.Second) / opts.RateLimit)
+	}
+	return n
+}
+
+// wait blocks until the rate limit allows another request.
+func (n *network) wait() {
+	if n.interval == 0 {
+		return
+	}
+	n.mu.Lock()
+	now := time.Now()
+	if n.next.Before(now) {
+		n.next = now
+	}
+	delay := n.next.Sub(now)
+	n.next = n.next.Add(n.interval)
+	n.mu.Unlock()
+	time.Sleep(delay)
+}
+
+// fetch sends a request and returns the body of its 2xx response.
+// Transport errors, 429s and 5xxs are retried after an exponential
+// backoff, or after the delay a Retry-After header asks for.
+func (n *network) fetch(method, target string, body []byte) ([]byte, error) {
+	n.sem <- struct{}{}
+	defer func() { <-n.sem }()
+
+	for attempt := 0; ; attempt++ {
+		n.wait()
+		data, retryAfter, err := n.once(method, target, body)
+		if err == nil || retryAfter < 0 || attempt >= n.retries || Interrupted() {
+			return data, err
+		}
+		if retryAfter == 0 {
+			backoff := 500 * time.Millisecond << attempt
+			retryAfter = backoff/2 + rand.N(backoff/2)
+		}
+		time.Sleep(retryAfter)
+	}
+}
+
+// once makes a single attempt. retryAfter is negative when a failure is
+// not worth retrying, and zero when no delay was asked for.
+func (n *network) once(method, target string, body []byte) (data []byte, retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(runContext(), method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, -1, err
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err = io.ReadAll(resp.Body)
+	if resp.StatusCode/100 == 2 {
+		return data, 0, err // A body cut short by the timeout is retried
+	}
+
+	u, _ := url.Parse(target)
+	err = fmt.Errorf("%s %s: %s", method, u.Redacted(), resp.Status)
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return nil, -1, err
+	}
+	if secs, convErr := strconv.Atoi(resp.Header.Get("Retry-After")); convErr == nil && secs >= 0 {
+		retryAfter = time.Duration(secs) * time.Second
+	}
+	return nil, retryAfter, err
+}
@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// 50. OVERLAY
+// ---------------------------------------------------------
+
+// OverlayFile is the go build -overlay configuration Options.Overlay
+// writes into OutputDir.
+const OverlayFile = "overlay.json"
+
+// overlayInput prepares an Overlay run: the split keeps the input's
+// package name and import path, and third_party goes beneath the
+// package, so the output drops into the input's module in place of the
+// package without a go.mod change. validateOptions has ruled out the
+// options that do not apply to an overlay.
+func (g *Generator) overlayInput(input string) error {
+	name, err := primaryPackage(input)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(input)
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	root, modPath, err := enclosingModule(dir)
+	if err != nil {
+		return fmt.Errorf("overlay: %w", err)
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return err
+	}
+	g.overlayDir = dir
+	g.PackageName = name
+	g.ProjectName = importPath(modPath, slashPath(rel))
+	g.ImportPrefix = importPath(g.ProjectName, "third_party")
+	return nil
+}
+
+// writeOverlay writes OverlayFile, laying every file of the output but
+// bradley's own over the input package's directory and hiding the input
+// files the split replaces. Nothing on disk moves:
+//
+//	go build -overlay mylib_split/overlay.json ./...
+//	go test -vet=off -overlay mylib_split/overlay.json ./...
+//
+// build and test the module as if the split were in place. go test needs
+// -vet=off: vet runs in each package's directory, and those of
+// third_party exist only in the overlay.
+func (g *Generator) writeOverlay() error {
+	out, err := filepath.Abs(g.OutputDir)
+	if err != nil {
+		return err
+	}
+	replace := map[string]string{}
+	for _, file := range g.splitFiles {
+		replace[file] = "" // Deleted, unless a generated file takes its name
+	}
+	own := []string{"go.mod", "go.sum", LockFile, ReportFile, IndexFile, ChangelogFile, OverlayFile}
+	err = filepath.WalkDir(out, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(out, p)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(own, rel) {
+			return nil
+		}
+		replace[filepath.Join(g.overlayDir, rel)] = p
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(struct{ Replace map[string]string }{replace}, "", "  ")
+	if err != nil {
+		return err
+	}
+	overlay := filepath.Join(g.OutputDir, OverlayFile)
+	fmt.Fprintf(progress(), "🪞 Overlay of %d files over %s: go build -overlay %s, go test -vet=off -overlay %[3]s\n", len(replace), g.overlayDir, overlay)
+	return g.emit(OverlayFile, append(data, '\n'))
+}
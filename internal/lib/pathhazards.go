@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 20. PATH HAZARDS
+// ---------------------------------------------------------
+
+// Imports that register types or descriptors under their full names.
+var registryImports = map[string]string{
+	"google.golang.org/protobuf/runtime/protoimpl": "protobuf registration",
+	"github.com/golang/protobuf/proto":             "protobuf registration",
+	"github.com/gogo/protobuf/proto":               "protobuf registration",
+}
+
+// pathHazards lists the ways a package's behavior may depend on its own
+// import path: asking reflection for package paths, naming itself in
+// string literals (registry keys, error prefixes), registering protobuf
+// types, or reading function names at run time.
+func pathHazards(modPath string, files []*ast.File) []string {
+	self := regexp.MustCompile(`(^|[^\w./-])` + regexp.QuoteMeta(modPath) + `([/.: "]|$)`)
+	found := map[string]bool{}
+	literals := 0
+	for _, file := range files {
+		for _, imp := range file.Imports {
+			p, _ := strconv.Unquote(imp.Path.Value)
+			if reason, ok := registryImports[p]; ok {
+				found[reason] = true
+			}
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.ImportSpec:
+				return false
+			case *ast.CallExpr:
+				sel, ok := x.Fun.(*ast.SelectorExpr)
+				if !ok {
+					break
+				}
+				switch {
+				case sel.Sel.Name == "PkgPath" && len(x.Args) == 0:
+					found["reflect PkgPath"] = true
+				case isPkgSelector(sel, "runtime", "FuncForPC", "CallersFrames"):
+					found["runtime function names"] = true
+				}
+			case *ast.BasicLit:
+				if x.Kind != token.STRING {
+					break
+				}
+				if s, err := strconv.Unquote(x.Value); err == nil && self.MatchString(s) {
+					literals++
+					if literals <= 3 {
+						found[fmt.Sprintf("string literal %q", s)] = true
+					}
+				}
+			}
+			return true
+		})
+	}
+	if literals > 3 {
+		found[fmt.Sprintf("%d more string literals naming %s", literals-3, modPath)] = true
+	}
+	reasons := make([]string, 0, len(found))
+	for reason := range found {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+func isPkgSelector(sel *ast.SelectorExpr, pkg string, names ...string) bool {
+	id, ok := sel.X.(*ast.Ident)
+	if !ok || id.Name != pkg {
+		return false
+	}
+	for _, name := range names {
+		if sel.Sel.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// recordPathHazards notes a shaded package's path hazards in the report.
+func (g *Generator) recordPathHazards(pkgPath, modPath string, files []*ast.File) {
+	reasons := pathHazards(modPath, files)
+	if len(reasons) == 0 {
+		return
+	}
+	if g.report.PathHazards == nil {
+		g.report.PathHazards = map[string][]string{}
+	}
+	g.report.PathHazards[pkgPath] = reasons
+}
+
+// analyzeVendor runs the path hazard analysis and the low-level
+// inventory over the vendored packages, before shading rewrites them.
+func (g *Generator) analyzeVendor(pkgs []string, owner map[string]string) error {
+	for _, pkg := range pkgs {
+		entries, _ := os.ReadDir(diskPath(g.vendorDir, pkg))
+		var files []*ast.File
+		var sources []string
+		for _, e := range entries {
+			sources = append(sources, e.Name())
+			path := filepath.Join(diskPath(g.vendorDir, pkg), e.Name())
+			if e.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+				continue
+			}
+			file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.SkipObjectResolution)
+			if err != nil {
+				return err
+			}
+			files = append(files, file)
+		}
+		g.recordPathHazards(pkg, owner[pkg], files)
+		g.recordLowLevel(pkg, files, sources)
+	}
+	if n := len(g.report.PathHazards); n > 0 {
+		warnf("%d shaded packages may depend on their import path; see %s", n, ReportFile)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package lib
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Import paths and module-relative paths are always slash-separated;
+// only paths handed to the file system go through path/filepath. Keep
+// every conversion between the two in this file.
+
+// importPath joins import path elements.
+func importPath(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// hasPathPrefix reports whether p is prefix or lies beneath it, element
+// by element ("a/bc" does not lie beneath "a/b").
+func hasPathPrefix(p, prefix string) bool {
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// diskPath turns slash-separated module-relative elements into an OS path
+// under root.
+func diskPath(root string, elem ...string) string {
+	return filepath.Join(root, filepath.FromSlash(path.Join(elem...)))
+}
+
+// slashPath turns an OS path into its slash-separated form, for import
+// paths and for anything recorded in manifests.
+func slashPath(p string) string {
+	return filepath.ToSlash(p)
+}
+
+// isLocalSlash reports whether the slash-separated p stays within the
+// directory it is relative to, see filepath.IsLocal.
+func isLocalSlash(p string) bool {
+	return filepath.IsLocal(filepath.FromSlash(p))
+}
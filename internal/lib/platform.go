@@ -0,0 +1,45 @@
+package lib
+
+import (
+	"strings"
+)
+
+// Mirrors go/build's syslist: every name here triggers an implicit build
+// constraint when it ends a file name, whether or not it is a supported
+// port today.
+var knownOS = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true,
+	"hurd": true, "illumos": true, "ios": true, "js": true, "linux": true, "nacl": true,
+	"netbsd": true, "openbsd": true, "plan9": true, "solaris": true, "wasip1": true,
+	"windows": true, "zos": true,
+}
+
+var knownArch = map[string]bool{
+	"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true, "arm64": true,
+	"arm64be": true, "loong64": true, "mips": true, "mipsle": true, "mips64": true,
+	"mips64le": true, "mips64p32": true, "mips64p32le": true, "ppc": true, "ppc64": true,
+	"ppc64le": true, "riscv": true, "riscv64": true, "s390": true, "s390x": true,
+	"sparc": true, "sparc64": true, "wasm": true,
+}
+
+// platformSuffix splits a Go file name into its stem and the
+// _GOOS, _GOARCH or _GOOS_GOARCH suffix the toolchain reads as an
+// implicit constraint, e.g. "fs_linux_amd64.go" -> ("fs", "linux_amd64").
+// A _test suffix is dropped first, as the toolchain does.
+func platformSuffix(name string) (stem, suffix string) {
+	stem = strings.TrimSuffix(strings.TrimSuffix(name, ".go"), "_test")
+	parts := strings.Split(stem, "_")
+	n := len(parts)
+	if n >= 3 && knownOS[parts[n-2]] && knownArch[parts[n-1]] {
+		return strings.Join(parts[:n-2], "_"), parts[n-2] + "_" + parts[n-1]
+	}
+	if n >= 2 && (knownOS[parts[n-1]] || knownArch[parts[n-1]]) {
+		return strings.Join(parts[:n-1], "_"), parts[n-1]
+	}
+	return stem, ""
+}
+
+// suffixConstraint spells a filename suffix as a //go:build expression.
+func suffixConstraint(suffix string) string {
+	return strings.ReplaceAll(suffix, "_", " && ")
+}
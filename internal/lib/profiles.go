@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+// 29. PROFILES
+// ---------------------------------------------------------
+
+// profileName restricts profile names to what can follow the output's
+// name in a directory and module path.
+var profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// GenerateProfiles generates one output per profile from a single run,
+// each named after the profile (mylib_split_min, mylib_split_full). The
+// dependencies are vendored once and every profile shades from that copy.
+// The input is loaded again for each profile, since generation rewrites
+// the syntax it is given.
+func GenerateProfiles(inputFile string, profiles map[string]Options) error {
+	names := slices.Sorted(maps.Keys(profiles))
+	for _, name := range names {
+		if !profileName.MatchString(name) {
+			return fmt.Errorf("bad profile name %q", name)
+		}
+	}
+	cache, err := os.MkdirTemp("", "bradley-vendor-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(cache)
+
+	for _, name := range names {
+		g := NewGenerator(inputFile, profiles[name])
+		g.setOutput(g.ProjectName + "_" + name)
+		g.vendored = filepath.Join(cache, "vendor")
+		fmt.Fprintf(progress(), "📐 Profile %s\n", name)
+		if err := g.generate(inputFile); err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// vendor fills g.vendorDir with the input module's dependencies. Under
+// GenerateProfiles only the first profile runs go mod vendor; it keeps a
+// copy in g.vendored which the others start from.
+func (g *Generator) vendor() error {
+	if g.vendored != "" {
+		if _, err := os.Stat(g.vendored); err == nil {
+			return copyDir(g.vendored, g.vendorDir)
+		}
+	}
+	args := []string{"mod", "vendor", "-o", g.vendorDir}
+	modfile, err := g.vendorModfile(filepath.Dir(g.vendorDir))
+	if err != nil {
+		return err
+	}
+	if modfile != "" {
+		args = append(args, "-modfile", modfile)
+	}
+	if err := runCmd(g.moduleDir, "go", args...); err != nil {
+		return err
+	}
+	if g.vendored == "" {
+		return nil
+	}
+	if _, err := os.Stat(g.vendorDir); os.IsNotExist(err) {
+		return os.MkdirAll(g.vendored, 0755) // Nothing to vendor
+	}
+	return copyDir(g.vendorDir, g.vendored)
+}
+
+// copyDir copies the tree at src to dst, keeping file modes and
+// symlinks.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			// Linked modules, see Options.Link
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		if d.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
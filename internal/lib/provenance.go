@@ -0,0 +1,46 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// 12. PROVENANCE
+// ---------------------------------------------------------
+
+// ProvenanceFile sits next to the sources of every shaded package.
+const ProvenanceFile = "PROVENANCE"
+
+// writeProvenance notes, for each shaded package, the module and version
+// it was copied from and the license that module ships, so third_party
+// code can be traced back without the lock file at hand.
+func (g *Generator) writeProvenance(owner map[string]string) error {
+	versions := map[string]string{}
+	for _, m := range g.modules {
+		versions[m.Path] = m.Version
+	}
+	licenses := map[string]string{}
+	for pkg, mod := range owner {
+		dir := diskPath(g.ThirdPartyDir, g.shadedPath(pkg))
+		if _, err := os.Stat(longPath(dir)); err != nil {
+			continue // Pruned, or kept from an earlier shared run
+		}
+		sidecar := longPath(filepath.Join(dir, ProvenanceFile))
+		if _, err := os.Stat(sidecar); err == nil && g.SharedThirdParty != "" {
+			continue // Shared copies keep the version first shaded
+		}
+		if _, ok := licenses[mod]; !ok {
+			licenses[mod] = describeLicense(detectLicense(diskPath(g.ThirdPartyDir, g.shadedPath(mod))))
+		}
+		text := fmt.Sprintf("Shaded by bradley; do not edit.\n\nmodule:  %s\nversion: %s\npackage: %s\nlicense: %s\n",
+			mod, versions[mod], pkg, licenses[mod])
+		if err := g.touch(sidecar); err != nil {
+			return err
+		}
+		if err := os.WriteFile(sidecar, []byte(text), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 11. THIRD_PARTY PRUNING
+// ---------------------------------------------------------
+
+// DefaultPruneDirs are the directories dropped from shaded modules when
+// Options.PruneDirs is nil.
+var DefaultPruneDirs = []string{"examples", "example", "_examples", "cmd"}
+
+func (g *Generator) pruneDirs() []string {
+	if g.PruneDirs == nil {
+		return DefaultPruneDirs
+	}
+	return g.PruneDirs
+}
+
+// pruneVendor removes directories named in PruneDirs from the vendor
+// tree before it is shaded. A directory survives when a vendored package
+// lies in it or when an enclosing package embeds files from it.
+func (g *Generator) pruneVendor(pkgs []string) error {
+	names := map[string]bool{}
+	for _, name := range g.pruneDirs() {
+		names[name] = true
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	vendored := map[string]bool{}
+	for _, pkg := range pkgs {
+		vendored[pkg] = true
+	}
+
+	var doomed []string
+	err := filepath.Walk(g.vendorDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() || !names[info.Name()] {
+			return err
+		}
+		rel := slashPath(strings.TrimPrefix(p, g.vendorDir+string(filepath.Separator)))
+		for _, pkg := range pkgs {
+			if hasPathPrefix(pkg, rel) {
+				return nil // Needed, keep walking for prunable subtrees
+			}
+		}
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if vendored[dir] && embedsFrom(diskPath(g.vendorDir, dir), strings.TrimPrefix(rel, dir+"/")) {
+				return filepath.SkipDir
+			}
+		}
+		doomed = append(doomed, p)
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range doomed {
+		fmt.Fprintf(progress(), "✂️  Pruning %s\n", slashPath(strings.TrimPrefix(p, g.vendorDir+string(filepath.Separator))))
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// embedsFrom reports whether a //go:embed directive in the package at dir
+// may match files under sub. Patterns with wildcards in the leading
+// elements are taken to match.
+func embedsFrom(dir, sub string) bool {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, file := range files {
+		// Read whole: bufio.Scanner stops at the first line past 64 KiB,
+		// and a directive below one would go unseen
+		src, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(src), "\n") {
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "//go:embed ") {
+				continue
+			}
+			for _, pattern := range strings.Fields(strings.TrimPrefix(line, "//go:embed ")) {
+				pattern = strings.TrimPrefix(strings.Trim(pattern, "\"`"), "all:")
+				if hasPathPrefix(pattern, sub) || hasPathPrefix(sub, pattern) || strings.ContainsAny(pattern, "*?[") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/mod/zip"
+)
+
+// 28. PUBLISHING
+// ---------------------------------------------------------
+
+// PublishOptions says where "bradley publish" sends a generated module:
+// a git remote the version is tagged and pushed to, or a module proxy
+// the module zip is uploaded to.
+type PublishOptions struct {
+	Version string `json:"version,omitempty"`
+	Remote  string `json:"remote,omitempty"` // git remote name or URL
+	Proxy   string `json:"proxy,omitempty"`  // base URL; files are PUT under <module>/@v/
+}
+
+// Publication records one published version in the lock.
+type Publication struct {
+	Version string    `json:"version"`
+	Target  string    `json:"target"`
+	Time    time.Time `json:"time"`
+}
+
+// Publish publishes the generated module in dir at opts.Version, the
+// network settings of run pacing a proxy upload. The publication is
+// recorded in the module's lock first, so the tag or zip carries it; the
+// lock is put back if publishing fails.
+func Publish(dir string, opts PublishOptions, run Options) error {
+	if (opts.Remote == "") == (opts.Proxy == "") {
+		return fmt.Errorf("publish: need exactly one of a git remote or a proxy")
+	}
+	lockFile := filepath.Join(dir, LockFile)
+	data, err := os.ReadFile(lockFile)
+	if err != nil {
+		return fmt.Errorf("publish: %s is not a generated module: %w", dir, err)
+	}
+	var lock Lock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return fmt.Errorf("%s: %w", lockFile, err)
+	}
+	if err := checkVersion(lock.Module, opts.Version, opts.Proxy != ""); err != nil {
+		return fmt.Errorf("publish: %v", err)
+	}
+	for _, p := range lock.Published {
+		if p.Version == opts.Version {
+			return fmt.Errorf("publish: %s %s was already published to %s", lock.Module, p.Version, p.Target)
+		}
+	}
+
+	target := opts.Remote
+	if opts.Proxy != "" {
+		u, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return fmt.Errorf("publish: proxy: %v", err)
+		}
+		u.User = nil // Keep credentials out of the lock
+		target = u.String()
+	}
+	lock.Published = append(lock.Published, Publication{Version: opts.Version, Target: target, Time: time.Now().UTC()})
+	updated, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(lockFile, append(updated, '\n'), 0644); err != nil {
+		return err
+	}
+
+	if opts.Proxy != "" {
+		err = uploadToProxy(dir, lock.Module, opts.Version, opts.Proxy, newNetwork(run))
+	} else {
+		err = pushTag(dir, lock.Module, opts.Version, opts.Remote)
+	}
+	if err != nil {
+		os.WriteFile(lockFile, data, 0644)
+		return fmt.Errorf("publish: %v", err)
+	}
+	fmt.Fprintf(progress(), "📤 Published %s %s to %s\n", lock.Module, opts.Version, target)
+	return nil
+}
+
+// checkVersion requires a canonical semantic version matching the major
+// version suffix of modPath. A proxy also needs modPath to be a valid
+// module path, which a sibling output's mylib_split is not.
+func checkVersion(modPath, version string, proxy bool) error {
+	if !semver.IsValid(version) || semver.Canonical(version) != version {
+		return fmt.Errorf("%q is not a canonical semantic version", version)
+	}
+	if proxy {
+		return module.Check(modPath, version)
+	}
+	_, pathMajor, _ := module.SplitPathVersion(modPath)
+	return module.CheckPathMajor(version, pathMajor)
+}
+
+// pushTag commits the module and tags the commit with version, prefixed
+// by the module's directory when it is nested inside a larger repository
+// (sub/v1.2.0), then pushes the tag, and only the tag, to remote. A
+// module outside any repository gets one of its own, whose branch the
+// commit goes on; one nested in the user's repository is committed
+// detached, leaving their branch and index as they were.
+func pushTag(dir, modPath, version, remote string) error {
+	top, err := cmdOutput(dir, "git", "rev-parse", "--show-toplevel")
+	if err != nil {
+		if err := git(dir, "init", "-q"); err != nil {
+			return err
+		}
+		top = dir
+	}
+	tag := version
+	absDir, _ := filepath.Abs(dir)
+	rel, err := filepath.Rel(top, absDir)
+	if err != nil {
+		return err
+	}
+	if rel != "." {
+		tag = slashPath(rel) + "/" + version
+	}
+	if err := git(dir, "rev-parse", "-q", "--verify", "refs/tags/"+tag); err == nil {
+		return fmt.Errorf("tag %s already exists", tag)
+	}
+	msg := fmt.Sprintf("Publish %s %s", modPath, version)
+	commit := "HEAD"
+	if rel == "." {
+		if err := git(dir, "add", "-A", "--", "."); err != nil {
+			return err
+		}
+		if err := git(dir, "commit", "-q", "-m", msg, "--", "."); err != nil {
+			return err
+		}
+	} else if commit, err = detachedCommit(dir, msg); err != nil {
+		return err
+	}
+	if err := git(dir, "tag", tag, commit); err != nil {
+		return err
+	}
+	return git(dir, "push", "-q", remote, "refs/tags/"+tag)
+}
+
+// detachedCommit commits the files of dir on top of HEAD without moving
+// any branch: they are staged in an index of their own, starting from
+// HEAD's tree. It returns the commit's hash.
+func detachedCommit(dir, msg string) (string, error) {
+	tmp, err := os.MkdirTemp("", "bradley-publish-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmp, "index")}
+
+	var parent []string
+	if head, err := gitOutput(dir, env, "rev-parse", "-q", "--verify", "HEAD^{commit}"); err == nil {
+		if _, err := gitOutput(dir, env, "read-tree", head); err != nil {
+			return "", err
+		}
+		parent = []string{"-p", head}
+	}
+	if _, err := gitOutput(dir, env, "add", "-A", "--", "."); err != nil {
+		return "", err
+	}
+	tree, err := gitOutput(dir, env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	return gitOutput(dir, env, slices.Concat([]string{"commit-tree", tree, "-m", msg}, parent)...)
+}
+
+// git runs a git command, returning its output with any failure.
+func git(dir string, args ...string) error {
+	_, err := gitOutput(dir, nil, args...)
+	return err
+}
+
+// gitOutput runs a git command with env added to the environment,
+// returning its trimmed output, or its combined output with a failure.
+func gitOutput(dir string, env []string, args ...string) (string, error) {
+	cmd := command("git", args...)
+	cmd.Dir = dir
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v\n%s", args[0], err, indent(strings.TrimSpace(string(out)+stderr.String())))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// uploadToProxy PUTs the .info, .mod and .zip files a module proxy serves
+// for modPath@version under <proxy>/<escaped path>/@v/ through net.
+// Credentials go in the proxy URL's user info.
+func uploadToProxy(dir, modPath, version, proxy string, net *network) error {
+	mv := module.Version{Path: modPath, Version: version}
+	var zipData bytes.Buffer
+	if err := zip.CreateFromDir(&zipData, mv, dir); err != nil {
+		return err
+	}
+	gomod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return err
+	}
+	info, _ := json.Marshal(struct {
+		Version string
+		Time    time.Time
+	}{version, time.Now().UTC()})
+
+	escPath, err := module.EscapePath(modPath)
+	if err != nil {
+		return err
+	}
+	escVersion, err := module.EscapeVersion(version)
+	if err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(proxy, "/") + "/" + escPath + "/@v/" + escVersion
+	for _, f := range []struct {
+		ext  string
+		data []byte
+	}{{".info", info}, {".mod", gomod}, {".zip", zipData.Bytes()}} {
+		if _, err := net.fetch(http.MethodPut, base+f.ext, f.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
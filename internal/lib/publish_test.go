@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestPushTagNested publishes a module nested in a repository and checks
+// that only its tag reaches the remote, and that the repository's branch
+// and index are left alone.
+func TestPushTagNested(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git")
+	}
+	for _, kv := range []string{"GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com", "GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com", "GIT_CONFIG_GLOBAL=/dev/null"} {
+		k, v, _ := strings.Cut(kv, "=")
+		t.Setenv(k, v)
+	}
+	tmp := t.TempDir()
+	repo, remote := filepath.Join(tmp, "repo"), filepath.Join(tmp, "remote.git")
+	run := func(dir string, args ...string) string {
+		t.Helper()
+		out, err := gitOutput(dir, nil, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	writeTree(t, repo, map[string]string{
+		"README":          "user's work\n",
+		"sub/go.mod":      "module example.com/repo/sub\n",
+		"sub/sub.go":      "package sub\n",
+		"sub/" + LockFile: `{"module": "example.com/repo/sub"}` + "\n",
+		"staged.txt":      "staged\n",
+	})
+	run(tmp, "init", "-q", "--bare", remote)
+	run(repo, "init", "-q", "-b", "main")
+	run(repo, "add", "README")
+	run(repo, "commit", "-q", "-m", "initial")
+	run(repo, "add", "staged.txt")
+	head := run(repo, "rev-parse", "HEAD")
+
+	if err := Publish(filepath.Join(repo, "sub"), PublishOptions{Version: "v1.0.0", Remote: remote}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := run(repo, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD moved from %s to %s", head, got)
+	}
+	if got := run(repo, "diff", "--cached", "--name-only"); got != "staged.txt" {
+		t.Errorf("index now stages %q, want only staged.txt", got)
+	}
+	if got := run(remote, "for-each-ref", "--format=%(refname)"); got != "refs/tags/sub/v1.0.0" {
+		t.Errorf("remote has %q, want only the tag", got)
+	}
+	files := run(remote, "ls-tree", "-r", "--name-only", "sub/v1.0.0")
+	for _, want := range []string{"README", "sub/go.mod", "sub/sub.go", "sub/" + LockFile} {
+		if !strings.Contains(files, want) {
+			t.Errorf("tagged tree lacks %s:\n%s", want, files)
+		}
+	}
+	if strings.Contains(files, "staged.txt") {
+		t.Errorf("tagged tree has the user's staged file")
+	}
+	if _, err := os.Stat(filepath.Join(repo, "sub", LockFile)); err != nil {
+		t.Fatal(err)
+	}
+}
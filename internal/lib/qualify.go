@@ -0,0 +1,199 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// 41. SUBPACKAGE SPLIT
+// ---------------------------------------------------------
+
+// writeSubpackages moves the declarations planSubpackages assigns to
+// subpackages into sub/ buckets of their own and returns those staying
+// in the root package. Every reference that now crosses a package
+// boundary is qualified first (Helper becomes util.Helper), which needs
+// the type checker's resolution: a name alone says nothing about
+// shadowing. Tests are qualified as they are written, see writeTests.
+func (g *Generator) writeSubpackages(base string, decls []ast.Decl, imports []*ast.ImportSpec) ([]ast.Decl, error) {
+	for _, decl := range decls {
+		if g.typesInfo(decl) == nil {
+			return nil, fmt.Errorf("subpackages: %s has no type information", g.Fset.Position(decl.Pos()).Filename)
+		}
+	}
+	plan, err := g.planSubpackages(decls)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.OK() {
+		return nil, fmt.Errorf("subpackages do not split cleanly (see bradley plan):\n%s", indent(plan.String()))
+	}
+	groupOf := map[string]string{}
+	for sub, names := range plan.Groups {
+		for _, name := range names {
+			groupOf[name] = sub
+		}
+	}
+
+	// A declaration goes where its first name (or its receiver) does
+	g.placed = map[types.Object]string{}
+	placement := make([]string, len(decls))
+	groups := map[string][]ast.Decl{}
+	for i, decl := range decls {
+		var idents []*ast.Ident
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil {
+				placement[i] = groupOf[receiverName(d)]
+			} else {
+				placement[i] = groupOf[d.Name.Name]
+				idents = append(idents, d.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					idents = append(idents, s.Name)
+				case *ast.ValueSpec:
+					idents = append(idents, s.Names...)
+				}
+			}
+			if names := declNames(decl); len(names) > 0 {
+				placement[i] = groupOf[names[0]]
+			}
+		}
+		info := g.typesInfo(decl)
+		for _, id := range idents {
+			if obj := info.Defs[id]; obj != nil {
+				g.placed[obj] = placement[i]
+			}
+		}
+		groups[placement[i]] = append(groups[placement[i]], decl)
+	}
+	for i, decl := range decls {
+		if err := g.qualify(decl, placement[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, sub := range slices.Sorted(maps.Keys(groups)) {
+		if sub == "" {
+			continue
+		}
+		var typeDecls, funcDecls, methodDecls []ast.Decl
+		for _, decl := range groups[sub] {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				typeDecls = append(typeDecls, d)
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					funcDecls = append(funcDecls, d)
+				} else {
+					methodDecls = append(methodDecls, d)
+				}
+			}
+		}
+		fmt.Fprintf(progress(), "📦 Subpackage %s: %d declarations\n", sub, len(groups[sub]))
+		if err := errors.Join(
+			g.writeBucket(diskPath(sub, bucketName(base, "types", "")), sub, typeDecls, imports),
+			g.writeBucket(diskPath(sub, bucketName(base, "funcs", "")), sub, funcDecls, imports),
+			g.writeBucket(diskPath(sub, bucketName(base, "methods", "")), sub, methodDecls, imports),
+		); err != nil {
+			return nil, err
+		}
+	}
+	return groups[""], nil
+}
+
+// qualify rewrites the references decl, which lives in package group
+// ("" for the root), makes to declarations placed in another package,
+// recording the import each rewritten identifier needs in g.qualified.
+// In an external test the package's own qualifier is swapped instead.
+func (g *Generator) qualify(decl ast.Decl, group string) error {
+	info, pkg := g.typesInfo(decl), g.typesPkg(decl)
+	if info == nil || pkg == nil {
+		return fmt.Errorf("subpackages: %s has no type information", g.Fset.Position(decl.Pos()).Filename)
+	}
+	var err error
+	astutil.Apply(decl, func(c *astutil.Cursor) bool {
+		if err != nil {
+			return false
+		}
+		switch x := c.Node().(type) {
+		case *ast.SelectorExpr:
+			id, ok := x.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if _, ok := info.Uses[id].(*types.PkgName); !ok {
+				return true
+			}
+			if to := g.placed[info.Uses[x.Sel]]; to != "" {
+				id.Name = to
+				g.qualifyAs(id, to)
+			}
+			return false
+		case *ast.Ident:
+			obj := info.Uses[x]
+			to, ok := g.placed[obj]
+			if !ok || to == group || obj.Pkg() != pkg {
+				return true
+			}
+			if !obj.Exported() {
+				err = fmt.Errorf("subpackages: %s refers to unexported %s in %s", g.Fset.Position(x.Pos()), x.Name, displayPkg(to))
+				return false
+			}
+			qualifier := g.qualifierFor(to)
+			if to == "" && g.PackageName == "main" {
+				err = fmt.Errorf("subpackages: %s refers to %s, but package main cannot be imported", g.Fset.Position(x.Pos()), x.Name)
+				return false
+			}
+			if scope := pkg.Scope().Innermost(x.Pos()); scope != nil {
+				if _, shadow := scope.LookupParent(qualifier, x.Pos()); shadow != nil {
+					err = fmt.Errorf("subpackages: %s: %s.%s would refer to the %s declared at %s", g.Fset.Position(x.Pos()),
+						qualifier, x.Name, qualifier, g.Fset.Position(shadow.Pos()))
+					return false
+				}
+			}
+			id := &ast.Ident{NamePos: x.Pos(), Name: qualifier}
+			c.Replace(&ast.SelectorExpr{X: id, Sel: x})
+			g.qualifyAs(id, to)
+			return false
+		}
+		return true
+	}, nil)
+	return err
+}
+
+// qualifierFor is the name package group is imported under.
+func (g *Generator) qualifierFor(group string) string {
+	if group == "" {
+		return g.PackageName
+	}
+	return group
+}
+
+// qualifyAs records that id now names package group, so preciseImports
+// imports it for the bucket holding id.
+func (g *Generator) qualifyAs(id *ast.Ident, group string) {
+	if g.qualified == nil {
+		g.qualified = map[*ast.Ident]*ast.ImportSpec{}
+	}
+	target := g.ProjectName
+	if group != "" {
+		target = importPath(g.ProjectName, group)
+	}
+	spec := &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(target)}}
+	if path.Base(target) != g.qualifierFor(group) {
+		spec.Name = ast.NewIdent(g.qualifierFor(group))
+	}
+	g.qualified[id] = spec
+}
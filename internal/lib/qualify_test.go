@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func TestWriteSubpackages(t *testing.T) {
+	const src = `package p
+
+import "strings"
+
+func HelperUpper(s string) string { return strings.ToUpper(s) }
+
+func Shout(s string) string { return HelperUpper(s) + "!" }
+`
+	g := NewGenerator("p.go", Options{Subpackages: map[string][]string{"util": {"Helper*"}}})
+	g.ProjectName, g.PackageName = "example.com/p_split", "p"
+	g.memory = map[string][]byte{}
+	file, err := parser.ParseFile(g.Fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Defs: map[*ast.Ident]types.Object{}, Uses: map[*ast.Ident]types.Object{}}
+	conf := types.Config{Importer: importer.ForCompiler(g.Fset, "source", nil)}
+	pkg, err := conf.Check("example.com/p", g.Fset, []*ast.File{file}, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.trackTypes(file, info, pkg)
+
+	rest, err := g.writeSubpackages("p", file.Decls[1:], file.Imports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.writeBucket("p_funcs.go", g.PackageName, rest, file.Imports); err != nil {
+		t.Fatal(err)
+	}
+
+	root := string(g.memory["p_funcs.go"])
+	for _, want := range []string{`"example.com/p_split/util"`, "return util.HelperUpper(s) + \"!\""} {
+		if !strings.Contains(root, want) {
+			t.Errorf("p_funcs.go lacks %s:\n%s", want, root)
+		}
+	}
+	if strings.Contains(root, `"strings"`) {
+		t.Errorf("p_funcs.go keeps an unused import:\n%s", root)
+	}
+	if sub := string(g.memory["util/p_funcs.go"]); !strings.Contains(sub, `"strings"`) {
+		t.Errorf("util/p_funcs.go lacks its import:\n%s", sub)
+	}
+}
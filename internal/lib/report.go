@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// ReportFile is written into OutputDir next to the lock file.
+const ReportFile = "bradley.report.json"
+
+// Report records what a run changed beyond moving declarations around,
+// for review before the output is committed.
+type Report struct {
+	// RemovedImports lists, per generated file, the imports it was
+	// offered but dropped as unused.
+	RemovedImports map[string][]string `json:"removed_imports,omitempty"`
+
+	// DroppedImports are input imports no generated file kept. A blank
+	// or dot import here means an init side effect is gone.
+	DroppedImports []string `json:"dropped_imports,omitempty"`
+
+	// PathHazards lists shaded packages whose behavior may depend on
+	// their import path, which shading changes, with the reasons why.
+	PathHazards map[string][]string `json:"path_hazards,omitempty"`
+
+	// RewrittenStrings lists the literals -rewrite-strings changed.
+	RewrittenStrings []Rewrite `json:"rewritten_strings,omitempty"`
+
+	// LinknameRewrites lists //go:linkname targets renamed after their
+	// package moved; LinknameWarnings those that could not be fixed.
+	LinknameRewrites []Rewrite `json:"linkname_rewrites,omitempty"`
+	LinknameWarnings []string  `json:"linkname_warnings,omitempty"`
+
+	// LowLevel inventories shaded packages importing unsafe or syscall,
+	// using cgo or containing assembly.
+	LowLevel map[string][]string `json:"low_level,omitempty"`
+
+	// LicenseViolations lists shaded modules breaking the license policy.
+	LicenseViolations []string `json:"license_violations,omitempty"`
+
+	// Dependencies summarizes the shaded modules, largest first.
+	Dependencies []DependencySummary `json:"dependencies,omitempty"`
+
+	// Changes lists how the shaded modules differ from the previous run's
+	// lock, when there was one.
+	Changes []ModuleChange `json:"changes,omitempty"`
+
+	// UpstreamWarnings flags shaded modules deprecated upstream or frozen
+	// at a retracted version, see checkUpstream.
+	UpstreamWarnings []string `json:"upstream_warnings,omitempty"`
+}
+
+// importKey spells an import the way it reads in source.
+func importKey(name, path string) string {
+	if name == "" {
+		return path
+	}
+	return name + " " + path
+}
+
+// recordImports notes which of the offered imports a generated file
+// kept, from its final source. An import counts as kept when the file
+// imports the same package under the same name, however it spells it:
+// preciseImports drops an alias that repeats the package's name, and
+// spells out the name of a package moved to another path.
+func (g *Generator) recordImports(filename string, offered []*ast.ImportSpec, src []byte) {
+	if g.keptImports == nil {
+		g.keptImports = map[string]bool{}
+		g.offeredImports = map[string]bool{}
+	}
+	kept := map[string]bool{}
+	if file, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly); err == nil {
+		for _, imp := range file.Imports {
+			name, path := importSpec(imp)
+			kept[g.importIdentity(name, path)] = true
+			g.keptImports[path] = true
+		}
+	}
+	var removed []string
+	for _, imp := range offered {
+		name, path := importSpec(imp)
+		key := importKey(name, path)
+		g.offeredImports[key] = true
+		if !kept[g.importIdentity(name, path)] {
+			removed = append(removed, key)
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	sort.Strings(removed)
+	if g.report.RemovedImports == nil {
+		g.report.RemovedImports = map[string][]string{}
+	}
+	g.report.RemovedImports[slashPath(filename)] = removed
+}
+
+// importSpec returns the name imp gives its package, "" for none, and
+// the path it imports.
+func importSpec(imp *ast.ImportSpec) (name, path string) {
+	if imp.Name != nil {
+		name = imp.Name.Name
+	}
+	return name, strings.Trim(imp.Path.Value, `"`)
+}
+
+// importIdentity is what an import makes available: the package it
+// resolves to, at the path the run moved it to if any, and the name it
+// is used under.
+func (g *Generator) importIdentity(name, path string) string {
+	if name == "" {
+		name = g.importNames[path]
+		if name == "" {
+			name = guessImportName(path)
+		}
+	}
+	if moved, ok := g.moved[path]; ok {
+		path = moved
+	}
+	return name + " " + path
+}
+
+// learnImportName records the name the package at path declares, for
+// importIdentity.
+func (g *Generator) learnImportName(path, name string) {
+	if g.importNames == nil {
+		g.importNames = map[string]string{}
+	}
+	g.importNames[path] = name
+}
+
+// writeReport settles the imports no file kept, warns about lost side
+// effects and writes the report.
+func (g *Generator) writeReport() error {
+	for key := range g.offeredImports {
+		_, path, _ := strings.Cut(key, " ")
+		if path == "" {
+			path = key
+		}
+		if g.keptImports[path] || g.keptImports[g.moved[path]] {
+			continue
+		}
+		g.report.DroppedImports = append(g.report.DroppedImports, key)
+		if strings.HasPrefix(key, "_ ") || strings.HasPrefix(key, ". ") {
+			warnf("Import %s is in no generated file; its side effects are lost", key)
+		}
+	}
+	sort.Strings(g.report.DroppedImports)
+
+	data, err := json.MarshalIndent(g.report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return g.emit(ReportFile, append(data, '\n'))
+}
@@ -0,0 +1,42 @@
+package lib
+
+import (
+	"go/ast"
+	"go/token"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestRecordImports(t *testing.T) {
+	spec := func(name, path string) *ast.ImportSpec {
+		imp := &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path)}}
+		if name != "" {
+			imp.Name = ast.NewIdent(name)
+		}
+		return imp
+	}
+	g := &Generator{report: &Report{}, moved: map[string]string{"example.com/p": "p_split"}}
+	g.learnImportName("example.com/go-yaml", "yaml")
+	offered := []*ast.ImportSpec{
+		spec("strings", "strings"),         // An alias repeating the name, dropped
+		spec("", "example.com/p"),          // Moved, and named after it
+		spec("yml", "example.com/go-yaml"), // Kept as written
+		spec("", "os"),                     // Really unused
+		spec("y", "example.com/go-yaml"),   // A second alias of the same package, unused
+	}
+	src := []byte(`package p_test
+
+import (
+	"strings"
+
+	p "p_split"
+	yml "example.com/go-yaml"
+)
+`)
+	g.recordImports("p_test.go", offered, src)
+	want := []string{"os", "y example.com/go-yaml"}
+	if got := g.report.RemovedImports["p_test.go"]; !slices.Equal(got, want) {
+		t.Errorf("removed %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 44. RUN LOCK
+// ---------------------------------------------------------
+
+// runLockMaxAge is how long a lock taken on another host is honoured;
+// on this host the holder's process is checked instead.
+const runLockMaxAge = 24 * time.Hour
+
+// runLock is the content of the lock file guarding an output directory.
+type runLock struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+// runLockPath is next to OutputDir rather than inside it, so it never
+// ends up in the module or its zip.
+func (g *Generator) runLockPath() string {
+	return filepath.Clean(g.OutputDir) + ".lock"
+}
+
+// lockOutput takes the advisory lock on OutputDir, so two runs targeting
+// it (parallel make targets, say) cannot interleave their writes. The
+// lock is written to a file of its own and hard-linked into place, so it
+// appears whole or not at all. A lock left behind by a run that died is
+// detected and taken over, see takeOver. The returned func releases the
+// lock, unless another run has taken it over meanwhile.
+func (g *Generator) lockOutput() (func(), error) {
+	path := g.runLockPath()
+	host, _ := os.Hostname()
+	mine, err := json.Marshal(runLock{PID: os.Getpid(), Host: host, Started: time.Now().UTC()})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	_, werr := tmp.Write(mine)
+	if cerr := tmp.Close(); werr != nil || cerr != nil {
+		os.Remove(tmp.Name())
+		return nil, errors.Join(werr, cerr)
+	}
+	defer os.Remove(tmp.Name())
+
+	release := func() {
+		if data, err := os.ReadFile(path); err == nil && bytes.Equal(data, mine) {
+			os.Remove(path)
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		err := os.Link(tmp.Name(), path)
+		if err == nil {
+			return release, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		held, data, err := readRunLock(path)
+		switch {
+		case os.IsNotExist(err):
+			continue // Released meanwhile
+		case err != nil:
+			return nil, err
+		case !held.stale(host) || attempt > 0:
+			return nil, fmt.Errorf("another run (pid %d on %s, started %s) is in progress on %s; remove %s if it is not",
+				held.PID, held.Host, held.Started.Local().Format(time.DateTime), g.OutputDir, path)
+		}
+		if err := takeOver(path, data); err != nil {
+			return nil, err
+		}
+		warnf("Replaced the stale lock of pid %d on %s", held.PID, held.Host)
+	}
+}
+
+// takeOver removes the stale lock at path, whose content was stale. It
+// first renames the lock aside, which only one of several runs finding
+// it stale can do, and puts it back should it turn out to be another
+// run's fresh lock rather than the stale one.
+func takeOver(path string, stale []byte) error {
+	aside := fmt.Sprintf("%s.stale.%d", path, os.Getpid())
+	if err := os.Rename(path, aside); err != nil {
+		if os.IsNotExist(err) {
+			return nil // Taken over or released meanwhile
+		}
+		return err
+	}
+	defer os.Remove(aside)
+	data, err := os.ReadFile(aside)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, stale) {
+		// Another run replaced it first: its lock goes back, and the next
+		// attempt finds it held
+		if err := os.Link(aside, path); err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRunLock reads the lock at path, returning its raw content too.
+// One that does not parse counts as taken on another host when the file
+// was written.
+func readRunLock(path string) (runLock, []byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return runLock{}, nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return runLock{}, nil, err
+	}
+	var l runLock
+	if json.Unmarshal(data, &l) != nil {
+		l = runLock{Host: "?", Started: info.ModTime()}
+	}
+	return l, data, nil
+}
+
+// stale reports whether the run holding l is gone: its process has
+// exited, for a run on host, or it started too long ago for one
+// elsewhere.
+func (l runLock) stale(host string) bool {
+	if l.Host == host {
+		return !processAlive(l.PID)
+	}
+	return time.Since(l.Started) > runLockMaxAge
+}
@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockOutput(t *testing.T) {
+	g := &Generator{OutputDir: filepath.Join(t.TempDir(), "p_split")}
+	host, _ := os.Hostname()
+	writeLock := func(l runLock) {
+		t.Helper()
+		data, err := json.Marshal(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(g.runLockPath(), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A live run's lock is honoured
+	writeLock(runLock{PID: os.Getpid(), Host: host, Started: time.Now()})
+	if _, err := g.lockOutput(); err == nil {
+		t.Fatal("lockOutput took the lock of a live run")
+	}
+
+	// A dead one's is taken over
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	writeLock(runLock{PID: cmd.Process.Pid, Host: host, Started: time.Now()})
+	release, err := g.lockOutput()
+	if err != nil {
+		t.Fatalf("lockOutput: %v, want the stale lock taken over", err)
+	}
+	if _, err := g.lockOutput(); err == nil {
+		t.Fatal("lockOutput took a lock held by this run")
+	}
+
+	// Releasing leaves a lock that is no longer ours in place
+	writeLock(runLock{PID: 1, Host: "elsewhere", Started: time.Now()})
+	release()
+	if _, err := os.Stat(g.runLockPath()); err != nil {
+		t.Fatalf("release removed another run's lock: %v", err)
+	}
+	os.Remove(g.runLockPath())
+
+	release, err = g.lockOutput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if _, err := os.Stat(g.runLockPath()); !os.IsNotExist(err) {
+		t.Fatalf("release left its own lock: %v", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(g.runLockPath())); len(entries) != 0 {
+		t.Errorf("lockOutput left %d files behind", len(entries))
+	}
+}
@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// 10. SHARED THIRD_PARTY
+// ---------------------------------------------------------
+
+// sharedPrefix is the module path of a shared third_party directory: its
+// base name, so "../deps/shaded" is imported as "shaded/...".
+func sharedPrefix(dir string) string {
+	abs, _ := filepath.Abs(dir)
+	return filepath.Base(abs)
+}
+
+// readSharedLock returns the modules already shaded into the shared
+// directory, or nil when it has not been set up yet.
+func (g *Generator) readSharedLock() (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(g.ThirdPartyDir, LockFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lock Lock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("%s: %w", LockFile, err)
+	}
+	versions := map[string]string{}
+	for _, m := range lock.Modules {
+		versions[m.Path] = m.Version
+	}
+	return versions, nil
+}
+
+// separateThirdParty reports whether shaded packages form a module of
+// their own, shared or under a Namespace, rather than being part of the
+// output module.
+func (g *Generator) separateThirdParty() bool {
+	return g.SharedThirdParty != "" || g.Namespace != ""
+}
+
+// setupShared makes the shared (or namespaced) directory a module of its own, records
+// the modules it now holds, and points the output module at it with a
+// local replace. A module already shared at another version is kept as
+// it is: every output using the directory builds against the same code.
+func (g *Generator) setupShared(shared map[string]string) error {
+	// Written below, by go mod init and tidy among others
+	if err := g.touch(filepath.Join(g.ThirdPartyDir, "go.mod"), filepath.Join(g.ThirdPartyDir, "go.sum"), filepath.Join(g.ThirdPartyDir, LockFile)); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(g.ThirdPartyDir, 0755); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(g.ThirdPartyDir, "go.mod")); os.IsNotExist(err) {
+		if err := runCmd(g.ThirdPartyDir, "go", "mod", "init", g.ImportPrefix); err != nil {
+			return fmt.Errorf("go mod init %s: %w", g.ImportPrefix, err)
+		}
+	}
+
+	if shared == nil {
+		shared = map[string]string{}
+	}
+	for _, m := range g.modules {
+		if have, ok := shared[m.Path]; ok && have != m.Version {
+			warnf("Shared %s stays at %s (%s wanted %s)", m.Path, have, g.ProjectName, m.Version)
+			continue
+		}
+		shared[m.Path] = m.Version
+	}
+	lock := Lock{Schema: LockSchemaVersion, Tool: ReadBuildInfo(), Module: g.ImportPrefix}
+	for _, path := range slices.Sorted(maps.Keys(shared)) {
+		lock.Modules = append(lock.Modules, LockedModule{Path: path, Version: shared[path]})
+	}
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(g.ThirdPartyDir, LockFile), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	for _, name := range []string{"go.mod", "go.sum", LockFile} {
+		g.recordCreated(filepath.Join(g.ThirdPartyDir, name))
+	}
+
+	rel, err := relativeDir(g.OutputDir, g.ThirdPartyDir)
+	if err != nil {
+		return err
+	}
+	return runCmd(g.OutputDir, "go", "mod", "edit",
+		"-require="+g.ImportPrefix+"@v0.0.0",
+		"-replace="+g.ImportPrefix+"="+rel)
+}
+
+// relativeDir spells target relative to dir the way a go.mod replace
+// directive needs it, always starting with ./ or ../.
+func relativeDir(dir, target string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absDir, absTarget)
+	if err != nil {
+		return "", err
+	}
+	rel = slashPath(rel)
+	if rel != ".." && !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel, nil
+}
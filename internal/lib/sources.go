@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"unicode/utf8"
+)
+
+// 38. PATHOLOGICAL INPUTS
+// ---------------------------------------------------------
+
+// SourceError reports input bradley refuses to split, bytes the Go
+// scanner rejects, by position and byte offset.
+type SourceError struct {
+	File   string
+	Offset int // in bytes from the start of the file
+	Line   int
+	Column int // in bytes, as go/token counts
+	Reason string
+}
+
+func (e *SourceError) Error() string {
+	return fmt.Sprintf("%s:%d:%d (byte %d): %s", e.File, e.Line, e.Column, e.Offset, e.Reason)
+}
+
+// checkSource looks through src for what the Go scanner chokes on
+// before any parser sees it, so the failure names the exact byte rather
+// than whatever the parser recovered to. Lines and literals of any
+// length are fine.
+func checkSource(name string, src []byte) error {
+	line, lineStart := 1, 0
+	for off := 0; off < len(src); {
+		r, size := utf8.DecodeRune(src[off:])
+		reason := ""
+		switch {
+		case r == utf8.RuneError && size == 1:
+			reason = fmt.Sprintf("invalid UTF-8 (byte 0x%02x)", src[off])
+		case r == 0:
+			reason = "NUL byte"
+		case r == '\uFEFF' && off > 0:
+			reason = "byte order mark after the start of the file"
+		}
+		if reason != "" {
+			return &SourceError{File: name, Offset: off, Line: line, Column: off - lineStart + 1, Reason: reason}
+		}
+		if r == '\n' {
+			line, lineStart = line+1, off+1
+		}
+		off += size
+	}
+	return nil
+}
+
+// checkInput runs checkSource over the files of the input, a Go file or
+// a package directory.
+func checkInput(input string) error {
+	files := []string{input}
+	if info, err := os.Stat(input); err == nil && info.IsDir() {
+		files = goFiles(input)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := checkSource(file, src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"go/format"
+	"strings"
+	"testing"
+)
+
+func TestCheckSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		offset int // -1 when the source is accepted
+		line   int
+		column int
+		reason string
+	}{
+		{"clean", "package p\n\nvar s = \"héllo\"\n", -1, 0, 0, ""},
+		{"leading BOM", "\uFEFFpackage p\n", -1, 0, 0, ""},
+		{"long line", "package p\n\nvar s = \"" + strings.Repeat("x", 1<<17) + "\"\n", -1, 0, 0, ""},
+		{"invalid UTF-8", "package p\n\nvar s = \"\xff\"\n", 20, 3, 10, "invalid UTF-8 (byte 0xff)"},
+		{"truncated rune", "package p\n// \xe2\x82\n", 13, 2, 4, "invalid UTF-8 (byte 0xe2)"},
+		{"NUL byte", "package p\n\nvar s = \"a\x00b\"\n", 21, 3, 11, "NUL byte"},
+		{"BOM in the middle", "package p\n\n\uFEFFvar x int\n", 11, 3, 1, "byte order mark after the start of the file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSource("x.go", []byte(tt.src))
+			if tt.offset < 0 {
+				if err != nil {
+					t.Fatalf("checkSource: %v, want nil", err)
+				}
+				return
+			}
+			var serr *SourceError
+			if !errors.As(err, &serr) {
+				t.Fatalf("checkSource: %v, want a *SourceError", err)
+			}
+			want := SourceError{File: "x.go", Offset: tt.offset, Line: tt.line, Column: tt.column, Reason: tt.reason}
+			if *serr != want {
+				t.Errorf("checkSource: %+v, want %+v", *serr, want)
+			}
+		})
+	}
+}
+
+// FuzzSplit sends arbitrary source through the whole in-memory split
+// (checkSource, parse, buckets, gofmt): it may reject the input, but
+// must not panic, and whatever it writes must be gofmt-clean Go.
+func FuzzSplit(f *testing.F) {
+	f.Add([]byte("package p\n\ntype T struct{ A int `json:\"a\"` }\n\nfunc (T) M() {}\n\nfunc F() {}\n\nvar V = 1\n"))
+	f.Add([]byte("//go:build linux\n\n// Package p does things.\npackage p\n\nimport \"fmt\"\n\n// F prints.\nfunc F() { fmt.Println() } // trailing\n\n// floating\n\nconst C = iota\n"))
+	f.Add([]byte("package p\n\ntype I interface{ M() }\n\nfunc G[T any](t T) T { return t }\n\n/* block */ var _ I\n"))
+	f.Add([]byte("\uFEFFpackage p\n\nvar s = \"\\x00\"\n"))
+	f.Add([]byte("package p\n\nfunc F() {\n\tgoto L\nL:\n}\n"))
+
+	f.Fuzz(func(t *testing.T, src []byte) {
+		out, err := GenerateInMemory(Source{Path: "example.com/p", Files: map[string][]byte{"p.go": src}}, nil, Options{})
+		if err != nil {
+			return
+		}
+		for name, data := range out {
+			if !strings.HasSuffix(name, ".go") {
+				continue
+			}
+			formatted, err := format.Source(data)
+			if err != nil {
+				t.Fatalf("%s is not valid Go: %v\n%s", name, err, data)
+			}
+			if !bytes.Equal(formatted, data) {
+				t.Fatalf("%s is not gofmt-clean:\n%s", name, data)
+			}
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"go/ast"
+	"go/token"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 21. STRING LITERAL REWRITING
+// ---------------------------------------------------------
+
+// Rewrite is one change made to follow shading outside import
+// declarations.
+type Rewrite struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// modulePathPattern matches the shaded modules' paths, longest first.
+// Whether a match starts a path of its own is left to shadeModulePaths:
+// a pattern testing the characters around it would consume them, and
+// miss the second of two paths one separator apart.
+func (g *Generator) modulePathPattern() *regexp.Regexp {
+	if len(g.modules) == 0 {
+		return nil
+	}
+	paths := make([]string, len(g.modules))
+	for i, m := range g.modules {
+		paths[i] = regexp.QuoteMeta(m.Path)
+	}
+	sort.Slice(paths, func(i, j int) bool { return len(paths[i]) > len(paths[j]) })
+	return regexp.MustCompile(strings.Join(paths, "|"))
+}
+
+// shadeModulePaths replaces the shaded modules' paths in s where they
+// start a path of their own: not preceded by a path character, so URLs
+// and already-shaded paths are left alone, and not followed by one that
+// would make it a longer name ("a/b" in "a/bc" or "a/b-x").
+func (g *Generator) shadeModulePaths(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range g.stringPattern.FindAllStringIndex(s, -1) {
+		start, end := loc[0], loc[1]
+		if start > 0 && isPathByte(s[start-1]) {
+			continue
+		}
+		if end < len(s) && (isWordByte(s[end]) || s[end] == '-') {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(importPath(g.ImportPrefix, g.shadedPath(s[start:end])))
+		last = end
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// isPathByte reports whether c can occur within a module path.
+func isPathByte(c byte) bool {
+	return isWordByte(c) || c == '.' || c == '/' || c == '-'
+}
+
+// isWordByte reports whether c matches \w.
+func isWordByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// rewriteStrings points string literals naming a shaded module at its
+// shaded path, recording each change under name in the report.
+func (g *Generator) rewriteStrings(file *ast.File, name string) bool {
+	if g.stringPattern == nil {
+		if g.stringPattern = g.modulePathPattern(); g.stringPattern == nil {
+			return false
+		}
+	}
+	changed := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.ImportSpec:
+			return false
+		case *ast.BasicLit:
+			if x.Kind != token.STRING {
+				break
+			}
+			s, err := strconv.Unquote(x.Value)
+			if err != nil {
+				break
+			}
+			rewritten := g.shadeModulePaths(s)
+			if rewritten == s {
+				break
+			}
+			from := x.Value
+			if strings.HasPrefix(x.Value, "`") && !strings.Contains(rewritten, "`") {
+				x.Value = "`" + rewritten + "`"
+			} else {
+				x.Value = strconv.Quote(rewritten)
+			}
+			g.report.RewrittenStrings = append(g.report.RewrittenStrings, Rewrite{
+				File: name,
+				Line: g.Fset.Position(x.Pos()).Line,
+				From: from,
+				To:   x.Value,
+			})
+			changed = true
+		}
+		return true
+	})
+	return changed
+}
@@ -0,0 +1,20 @@
+package lib
+
+import "testing"
+
+func TestShadeModulePaths(t *testing.T) {
+	g := &Generator{ImportPrefix: "out/third_party", modules: []LockedModule{{Path: "a/b"}, {Path: "a/b/c"}}}
+	g.stringPattern = g.modulePathPattern()
+	for _, tt := range []struct{ in, want string }{
+		{"a/b", "out/third_party/a/b"},
+		{"a/b a/b", "out/third_party/a/b out/third_party/a/b"},
+		{"a/b/c/d", "out/third_party/a/b/c/d"},
+		{"(a/b), a/b; a/b,a/b\na/b", "(out/third_party/a/b), out/third_party/a/b; out/third_party/a/b,out/third_party/a/b\nout/third_party/a/b"},
+		{`"a/b".Run`, `"out/third_party/a/b".Run`},
+		{"a/bc a/b-x xa/b x.a/b https://a/b", "a/bc a/b-x xa/b x.a/b https://a/b"},
+	} {
+		if got := g.shadeModulePaths(tt.in); got != tt.want {
+			t.Errorf("shadeModulePaths(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
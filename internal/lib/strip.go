@@ -0,0 +1,81 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 15. COMMENT STRIPPING
+// ---------------------------------------------------------
+
+var (
+	licenseHeader   = regexp.MustCompile(`(?i)copyright|license`)
+	generatedHeader = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+)
+
+// stripComments drops every comment of file except a license header
+// above the package clause, the generated-code marker, and lines the
+// toolchain reads: build constraints and //go:, //export and //line
+// directives.
+func stripComments(file *ast.File) {
+	var kept []*ast.CommentGroup
+	for _, group := range file.Comments {
+		if group.Pos() < file.Package && licenseHeader.MatchString(group.Text()) {
+			kept = append(kept, group)
+			continue
+		}
+		var directives []*ast.Comment
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, "//go:") || strings.HasPrefix(c.Text, "// +build") ||
+				strings.HasPrefix(c.Text, "//export ") || strings.HasPrefix(c.Text, "//line ") ||
+				generatedHeader.MatchString(c.Text) {
+				directives = append(directives, c)
+			}
+		}
+		if len(directives) > 0 {
+			kept = append(kept, &ast.CommentGroup{List: directives})
+		}
+	}
+	file.Comments = kept
+	file.Doc = nil
+}
+
+// stripThirdPartyComments rewrites the shaded sources without their
+// comments. Linked files belong to the module cache and are skipped.
+func (g *Generator) stripThirdPartyComments() error {
+	stripped := 0
+	err := filepath.Walk(longPathRoot(g.ThirdPartyDir), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".go") || info.Mode()&os.ModeSymlink != 0 {
+			return err
+		}
+		file, err := parser.ParseFile(g.Fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		if len(file.Comments) == 0 {
+			return nil
+		}
+		stripComments(file)
+		var buf bytes.Buffer
+		if err := format.Node(&buf, g.Fset, file); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		stripped++
+		if err := g.touch(path); err != nil {
+			return err
+		}
+		return os.WriteFile(path, buf.Bytes(), info.Mode().Perm())
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(progress(), "🧹 Stripped comments from %d shaded files\n", stripped)
+	return nil
+}
@@ -0,0 +1,279 @@
+package lib
+
+import (
+	"fmt"
+	"go/ast"
+	"maps"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// 8. SUBPACKAGE PLANNING
+// ---------------------------------------------------------
+
+// Plan assigns every package-level declaration to the root package ("")
+// or to one of the requested subpackages.
+type Plan struct {
+	Groups     map[string][]string // subpackage -> declaration names, sorted
+	Merged     [][]string          // subpackages folded together to break cycles
+	Cycles     []Cycle             // cycles left in place under the report strategy
+	Unexported []string            // cross-package references to unexported names
+}
+
+// Cycle is a set of subpackages importing each other, with the
+// references that would have to move to break it.
+type Cycle struct {
+	Packages []string
+	Break    []string // "from -> to" declaration references
+}
+
+func (p *Plan) OK() bool {
+	return len(p.Cycles) == 0 && len(p.Unexported) == 0
+}
+
+// PlanSubpackages loads input and plans the subpackage split opts asks
+// for, without writing anything.
+func PlanSubpackages(input string, opts Options) (*Plan, error) {
+	g := NewGenerator(input, opts)
+	pkg, err := g.loadInput(input)
+	if err != nil {
+		return nil, err
+	}
+	return g.planSubpackages(collectDecls(pkg.Files))
+}
+
+// planSubpackages builds the declaration reference graph, lifts it to
+// the proposed packages and resolves cycles between them: with the
+// "merge" strategy the packages on a cycle are folded into one (the root
+// package if it takes part), otherwise the cycle is reported together
+// with the lightest set of references that closes it.
+func (g *Generator) planSubpackages(decls []ast.Decl) (*Plan, error) {
+	// Methods travel with their receiver type
+	nodes := map[string][]ast.Node{}
+	var order []string
+	for _, decl := range decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil {
+			name := receiverName(fn)
+			nodes[name] = append(nodes[name], fn)
+			continue
+		}
+		for _, name := range declNames(decl) {
+			if _, ok := nodes[name]; !ok {
+				order = append(order, name)
+			}
+			nodes[name] = append(nodes[name], decl)
+		}
+	}
+	pkgNames := map[string]bool{}
+	for name := range nodes {
+		pkgNames[name] = true
+	}
+
+	for sub, patterns := range g.Subpackages {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("subpackage %s: bad pattern %q", sub, pattern)
+			}
+		}
+	}
+	groupOf := map[string]string{}
+	for _, name := range order {
+		groupOf[name] = g.subpackageFor(name)
+	}
+
+	refs := map[string]map[string]bool{}
+	for _, name := range order {
+		refs[name] = map[string]bool{}
+		for _, node := range nodes[name] {
+			for ref := range g.packageRefs(node, name, pkgNames) {
+				refs[name][ref] = true
+			}
+		}
+	}
+
+	plan := &Plan{}
+	for {
+		edges := map[string]map[string][]string{} // from -> to -> references
+		for _, name := range order {
+			for ref := range refs[name] {
+				from, to := groupOf[name], groupOf[ref]
+				if from == to {
+					continue
+				}
+				if edges[from] == nil {
+					edges[from] = map[string][]string{}
+				}
+				edges[from][to] = append(edges[from][to], name+" -> "+ref)
+			}
+		}
+
+		var cycles [][]string
+		for _, scc := range stronglyConnected(edges) {
+			if len(scc) > 1 {
+				cycles = append(cycles, scc)
+			}
+		}
+		if len(cycles) == 0 {
+			for _, name := range order {
+				for ref := range refs[name] {
+					if groupOf[name] != groupOf[ref] && !ast.IsExported(ref) {
+						plan.Unexported = append(plan.Unexported, fmt.Sprintf("%s (%s) -> %s (%s)",
+							name, displayPkg(groupOf[name]), ref, displayPkg(groupOf[ref])))
+					}
+				}
+			}
+			break
+		}
+
+		if g.CycleStrategy != "merge" {
+			for _, scc := range cycles {
+				plan.Cycles = append(plan.Cycles, Cycle{Packages: scc, Break: lightestEdge(scc, edges)})
+			}
+			break
+		}
+		for _, scc := range cycles {
+			target := scc[0] // Sorted, so the root package wins when present
+			for _, name := range order {
+				if slices.Contains(scc, groupOf[name]) {
+					groupOf[name] = target
+				}
+			}
+			plan.Merged = append(plan.Merged, scc)
+		}
+	}
+
+	plan.Groups = map[string][]string{}
+	for _, name := range order {
+		plan.Groups[groupOf[name]] = append(plan.Groups[groupOf[name]], name)
+	}
+	for _, names := range plan.Groups {
+		sort.Strings(names)
+	}
+	sort.Strings(plan.Unexported)
+	return plan, nil
+}
+
+// subpackageFor matches a declaration name against the requested
+// subpackages' patterns; unmatched names stay in the root package.
+func (g *Generator) subpackageFor(name string) string {
+	for _, sub := range slices.Sorted(maps.Keys(g.Subpackages)) {
+		for _, pattern := range g.Subpackages[sub] {
+			if ok, _ := path.Match(pattern, name); ok {
+				return sub
+			}
+		}
+	}
+	return ""
+}
+
+// stronglyConnected runs Tarjan's algorithm over the package graph,
+// returning each component sorted.
+func stronglyConnected(edges map[string]map[string][]string) [][]string {
+	var nodes []string
+	seen := map[string]bool{}
+	for from, tos := range edges {
+		for _, n := range append([]string{from}, slices.Sorted(maps.Keys(tos))...) {
+			if !seen[n] {
+				seen[n] = true
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	sort.Strings(nodes)
+
+	index, low := map[string]int{}, map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var out [][]string
+	var connect func(v string)
+	connect = func(v string) {
+		index[v], low[v] = len(index), len(index)
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range slices.Sorted(maps.Keys(edges[v])) {
+			if _, ok := index[w]; !ok {
+				connect(w)
+				low[v] = min(low[v], low[w])
+			} else if onStack[w] {
+				low[v] = min(low[v], index[w])
+			}
+		}
+		if low[v] == index[v] {
+			var scc []string
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				scc = append(scc, w)
+				if w == v {
+					break
+				}
+			}
+			sort.Strings(scc)
+			out = append(out, scc)
+		}
+	}
+	for _, n := range nodes {
+		if _, ok := index[n]; !ok {
+			connect(n)
+		}
+	}
+	return out
+}
+
+// lightestEdge picks, within a cycle, the package edge carried by the
+// fewest declaration references: moving those breaks the cycle cheapest.
+func lightestEdge(scc []string, edges map[string]map[string][]string) []string {
+	var best []string
+	for _, from := range scc {
+		for _, to := range scc {
+			refs := edges[from][to]
+			if len(refs) > 0 && (best == nil || len(refs) < len(best)) {
+				best = refs
+			}
+		}
+	}
+	sort.Strings(best)
+	return best
+}
+
+func displayPkg(sub string) string {
+	if sub == "" {
+		return "root"
+	}
+	return sub
+}
+
+func displayPkgs(subs []string) string {
+	names := make([]string, len(subs))
+	for i, sub := range subs {
+		names[i] = displayPkg(sub)
+	}
+	return strings.Join(names, ", ")
+}
+
+// String renders the plan for the terminal.
+func (p *Plan) String() string {
+	var b strings.Builder
+	for _, sub := range slices.Sorted(maps.Keys(p.Groups)) {
+		fmt.Fprintf(&b, "%s:\n", displayPkg(sub))
+		for _, name := range p.Groups[sub] {
+			fmt.Fprintf(&b, "  %s\n", name)
+		}
+	}
+	for _, m := range p.Merged {
+		fmt.Fprintf(&b, "merged to break a cycle: %s\n", displayPkgs(m))
+	}
+	for _, c := range p.Cycles {
+		fmt.Fprintf(&b, "cycle between %s; moving these references breaks it:\n", displayPkgs(c.Packages))
+		for _, ref := range c.Break {
+			fmt.Fprintf(&b, "  %s\n", ref)
+		}
+	}
+	for _, u := range p.Unexported {
+		fmt.Fprintf(&b, "unexported across packages: %s\n", u)
+	}
+	return b.String()
+}
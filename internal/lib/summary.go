@@ -0,0 +1,97 @@
+package lib
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"text/tabwriter"
+)
+
+// 25. DEPENDENCY SUMMARY
+// ---------------------------------------------------------
+
+// DependencySummary describes one shaded module as it ended up in
+// third_party.
+type DependencySummary struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Size    int64  `json:"size"`
+	Files   int    `json:"files"`
+	License string `json:"license"`
+
+	// Filled from deps.dev with DepsDev, see enrichDependencies.
+	Latest     string  `json:"latest,omitempty"`
+	Repository string  `json:"repository,omitempty"`
+	Stars      int     `json:"stars,omitempty"`
+	Scorecard  float64 `json:"scorecard,omitempty"`
+	Archived   bool    `json:"archived,omitempty"`
+}
+
+// summarizeDependencies prints a table of the shaded modules, largest
+// first, and keeps it in the report.
+func (g *Generator) summarizeDependencies() error {
+	if len(g.modules) == 0 {
+		return nil
+	}
+	sizes, files, _, err := g.moduleSizes()
+	if err != nil {
+		return err
+	}
+	var deps []DependencySummary
+	for _, m := range g.modules {
+		if _, ok := g.layout[m.Path]; !ok {
+			continue
+		}
+		deps = append(deps, DependencySummary{
+			Path:    m.Path,
+			Version: m.Version,
+			Size:    sizes[m.Path],
+			Files:   files[m.Path],
+			License: describeLicense(g.shadedLicense(m.Path)),
+		})
+	}
+	sort.SliceStable(deps, func(i, j int) bool {
+		if deps[i].Size != deps[j].Size {
+			return deps[i].Size > deps[j].Size
+		}
+		return deps[i].Path < deps[j].Path
+	})
+	if g.DepsDev {
+		g.enrichDependencies(deps)
+	}
+	g.report.Dependencies = deps
+
+	tw := tabwriter.NewWriter(progress(), 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "MODULE\tVERSION\tSIZE\tFILES\tLICENSE\t")
+	if g.DepsDev {
+		fmt.Fprint(tw, "LATEST\tSTARS\tSCORECARD\t")
+	}
+	fmt.Fprintln(tw)
+	for _, d := range deps {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t", d.Path, d.Version, formatSize(d.Size), d.Files, d.License)
+		if g.DepsDev {
+			fmt.Fprintf(tw, "%s\t%d\t%.1f\t", d.Latest, d.Stars, d.Scorecard)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// shadedLicense detects the license of a module already in third_party.
+func (g *Generator) shadedLicense(mod string) license {
+	if g.memory == nil {
+		return detectLicense(diskPath(g.ThirdPartyDir, g.shadedPath(mod)))
+	}
+	root := path.Join("third_party", g.shadedPath(mod))
+	var names []string
+	for name := range g.memory {
+		if path.Dir(name) == root && isLicenseFile(path.Base(name)) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return license{}
+	}
+	sort.Strings(names)
+	return license{id: identifyLicense(string(g.memory[names[0]])), file: path.Base(names[0])}
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"errors"
+	"go/ast"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 40. TEST FILES
+// ---------------------------------------------------------
+
+// writeTests writes the test declarations of one test package to its
+// test bucket, except for Example, Benchmark and Fuzz functions: those go
+// to example_test.go, base_bench_test.go and base_fuzz_test.go (with
+// _internal before _test inside the package), keeping the main test
+// files to tests proper.
+func (g *Generator) writeTests(base, pkgName string, decls []ast.Decl, imports []*ast.ImportSpec, suffix string) error {
+	kind := "test"
+	if pkgName == g.PackageName {
+		kind = "internal_test"
+	}
+	files := map[string][]ast.Decl{}
+	for _, decl := range decls {
+		if g.placed != nil {
+			// Tests stay in the root package; see writeSubpackages
+			if err := g.qualify(decl, ""); err != nil {
+				return err
+			}
+		}
+		name := bucketName(base, kind, suffix)
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+			switch {
+			case isTestFunc(fn.Name.Name, "Example"):
+				name = bucketName("example", kind, suffix)
+			case isTestFunc(fn.Name.Name, "Benchmark"):
+				name = bucketName(base, "bench_"+kind, suffix)
+			case isTestFunc(fn.Name.Name, "Fuzz"):
+				name = bucketName(base, "fuzz_"+kind, suffix)
+			}
+		}
+		files[name] = append(files[name], decl)
+	}
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		errs = append(errs, g.writeBucket(name, pkgName, files[name], imports))
+	}
+	return errors.Join(errs...)
+}
+
+// fuzzTests names the fuzz tests of pkg, whose seed corpora live in
+// testdata/fuzz/<name> beside them.
+func fuzzTests(pkg *inputPackage) []string {
+	var names []string
+	for _, decl := range collectDecls(slices.Concat(pkg.Tests, pkg.ExternalTests)) {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && isTestFunc(fn.Name.Name, "Fuzz") {
+			names = append(names, fn.Name.Name)
+		}
+	}
+	return names
+}
+
+// copyFuzzCorpora copies the seed corpus of each fuzz test of pkg from
+// the input directory dir into the output, where the moved test looks
+// for it.
+func (g *Generator) copyFuzzCorpora(dir string, pkg *inputPackage) error {
+	for _, name := range fuzzTests(pkg) {
+		corpus := filepath.Join(dir, "testdata", "fuzz", name)
+		if info, err := os.Stat(corpus); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := g.touch(filepath.Join(g.OutputDir, "testdata", "fuzz", name)); err != nil {
+			return err
+		}
+		if err := copyDir(corpus, filepath.Join(g.OutputDir, "testdata", "fuzz", name)); err != nil {
+			return err
+		}
+		g.recordCreated(filepath.Join(g.OutputDir, "testdata", "fuzz", name))
+	}
+	return nil
+}
+
+// isTestFunc reports whether name is a test function of the given kind
+// (Test, Benchmark, Fuzz, Example) the way go test recognizes it: the
+// prefix alone, or followed by anything but a lower-case letter.
+func isTestFunc(name, prefix string) bool {
+	if len(name) < len(prefix) || name[:len(prefix)] != prefix {
+		return false
+	}
+	if len(name) == len(prefix) {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return !unicode.IsLower(r)
+}
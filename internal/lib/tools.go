@@ -0,0 +1,136 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// 31. TOOL DEPENDENCIES
+// ---------------------------------------------------------
+
+// inputTools finds the tool dependencies of the module holding input:
+// the packages of its go.mod tool directives, and the blank imports of
+// tools.go-style files (built only with the "tools" tag) at the module
+// root or in tools/.
+func inputTools(input string) (directives, blank []string, err error) {
+	root, _, err := enclosingModule(input)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return nil, nil, err
+	}
+	mf, err := modfile.Parse("go.mod", data, nil) // ParseLax skips tool directives
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, t := range mf.Tool {
+		if t.Path != selfPath() { // see vendorModfile
+			directives = append(directives, t.Path)
+		}
+	}
+
+	for _, dir := range []string{root, filepath.Join(root, "tools")} {
+		for _, path := range goFiles(dir) {
+			file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly|parser.ParseComments)
+			if err != nil || !toolsOnly(file.Comments, file.Package) {
+				continue
+			}
+			for _, imp := range file.Imports {
+				if imp.Name != nil && imp.Name.Name == "_" {
+					p, _ := strconv.Unquote(imp.Path.Value)
+					if !slices.Contains(blank, p) {
+						blank = append(blank, p)
+					}
+				}
+			}
+		}
+	}
+	return directives, blank, nil
+}
+
+// toolsOnly reports whether a file's build constraint needs the "tools"
+// tag.
+func toolsOnly(comments []*ast.CommentGroup, pkg token.Pos) bool {
+	for _, group := range comments {
+		if group.Pos() > pkg {
+			break
+		}
+		for _, c := range group.List {
+			if !constraint.IsGoBuild(c.Text) {
+				continue
+			}
+			if expr, err := constraint.Parse(c.Text); err == nil && !satisfiable(expr, "tools") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// shadeTools carries the input's tool dependencies over to the output.
+// go mod vendor already brings their packages into third_party; with
+// Tools the output refers to them the way the input did, through tool
+// directives or a tools.go, so it can regenerate its code offline.
+// Without Tools they are only pointed out.
+func (g *Generator) shadeTools(input string) error {
+	directives, blank, err := inputTools(input)
+	if errors.Is(err, errNoModule) {
+		return nil // Nothing was vendored either
+	}
+	if err != nil {
+		return err
+	}
+	shaded := func(paths []string) []string {
+		var kept []string
+		for _, p := range paths {
+			for mod := range g.layout {
+				if hasPathPrefix(p, mod) {
+					kept = append(kept, p)
+					break
+				}
+			}
+		}
+		return kept
+	}
+	directives, blank = shaded(directives), shaded(blank)
+	if len(directives)+len(blank) == 0 {
+		return nil
+	}
+	if !g.Tools {
+		fmt.Fprintf(progress(), "🔧 Tool dependencies not carried over (use -tools): %s\n", strings.Join(append(directives, blank...), ", "))
+		return nil
+	}
+
+	for _, p := range directives {
+		if err := runCmd(g.OutputDir, "go", "mod", "edit", "-tool="+importPath(g.ImportPrefix, g.shadedPath(p))); err != nil {
+			return fmt.Errorf("go mod edit -tool %s: %w", p, err)
+		}
+	}
+	if len(blank) > 0 {
+		// Written with the original paths; the shading pass rewrites them
+		var src strings.Builder
+		fmt.Fprintf(&src, "//go:build tools\n\npackage %s\n\nimport (\n", g.PackageName)
+		for _, p := range blank {
+			fmt.Fprintf(&src, "\t_ %q\n", p)
+		}
+		src.WriteString(")\n")
+		if err := g.emit("tools.go", []byte(src.String())); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(progress(), "🔧 Carried over %d tool dependencies\n", len(directives)+len(blank))
+	return nil
+}
@@ -0,0 +1,120 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// 32. UPDATES
+// ---------------------------------------------------------
+
+// ChangelogFile is the release-notes fragment "bradley update" writes
+// into OutputDir.
+const ChangelogFile = "bradley.changelog.md"
+
+// UpdateFiles upgrades the dependencies of the input package (go get -u)
+// after a previous run, regenerates, and writes a CHANGELOG fragment
+// listing every module that changed with links to the new version. The
+// upgrade only reaches the output: the input module's go.mod and go.sum
+// stay as they were.
+func UpdateFiles(inputFile string, opts Options) error {
+	g := NewGenerator(inputFile, opts)
+	where := NewGenerator(inputFile, opts) // generate nests g itself
+	if where.Nested {
+		if err := where.nestInModule(inputFile); err != nil {
+			return err
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(where.OutputDir, LockFile))
+	if err != nil {
+		return fmt.Errorf("nothing to update, run bradley first: %w", err)
+	}
+	var prev Lock
+	if err := json.Unmarshal(data, &prev); err != nil {
+		return fmt.Errorf("%s: %w", LockFile, err)
+	}
+
+	if len(prev.Modules) > 0 {
+		dir := inputFile
+		if info, err := os.Stat(inputFile); err == nil && !info.IsDir() {
+			dir = filepath.Dir(inputFile)
+		}
+		root, _, err := enclosingModule(dir)
+		if err != nil {
+			return err
+		}
+		// The upgrade goes into a copy of go.mod the run then loads and
+		// vendors with, leaving the user's module as it is
+		scratch, err := os.MkdirTemp("", "bradley-update-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(scratch)
+		if g.modFile, err = scratchModfile(root, scratch); err != nil {
+			return err
+		}
+
+		// Upgrading the package's dependencies rather than the locked
+		// modules by name keeps modules the input dropped from coming back.
+		fmt.Fprintln(progress(), "⬆️  Updating dependencies...")
+		cmd := command("go", "get", "-modfile="+g.modFile, "-u", ".")
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("go get -u: %v\n%s", err, indent(strings.TrimSpace(string(out))))
+		}
+	}
+
+	if err := g.generate(inputFile); err != nil {
+		return err
+	}
+	fragment := changelog(g.report.Changes)
+	fmt.Fprint(progress(), fragment)
+	return g.emit(ChangelogFile, []byte(fragment))
+}
+
+// changelog renders changes as a Markdown fragment for release notes.
+func changelog(changes []ModuleChange) string {
+	var b strings.Builder
+	b.WriteString("### Shaded dependencies\n\n")
+	if len(changes) == 0 {
+		b.WriteString("No changes.\n")
+	}
+	for _, c := range changes {
+		switch {
+		case c.Old == "":
+			fmt.Fprintf(&b, "- Added %s %s (%s)\n", c.Path, c.New, docLink(c.Path, c.New))
+		case c.New == "":
+			fmt.Fprintf(&b, "- Removed %s %s\n", c.Path, c.Old)
+		default:
+			fmt.Fprintf(&b, "- Bumped %s %s → %s (%s", c.Path, c.Old, c.New, docLink(c.Path, c.New))
+			if compare := compareLink(c); compare != "" {
+				fmt.Fprintf(&b, ", [diff](%s)", compare)
+			}
+			b.WriteString(")\n")
+		}
+	}
+	return b.String()
+}
+
+// docLink points at a module version's page on pkg.go.dev.
+func docLink(path, version string) string {
+	return fmt.Sprintf("[%s](https://pkg.go.dev/%s@%s)", version, path, version)
+}
+
+// compareLink points at the commits between two versions for modules
+// hosted on GitHub, or returns "" for other hosts. Only modules at the
+// repository root are linked; nested modules tag with a prefix this
+// cannot guess reliably.
+func compareLink(c ModuleChange) string {
+	prefix, _, _ := module.SplitPathVersion(c.Path)
+	parts := strings.Split(prefix, "/")
+	if len(parts) != 3 || parts[0] != "github.com" {
+		return ""
+	}
+	return fmt.Sprintf("https://github.com/%s/%s/compare/%s...%s", parts[1], parts[2], c.Old, c.New)
+}
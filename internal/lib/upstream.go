@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// 33. UPSTREAM STATUS
+// ---------------------------------------------------------
+
+// checkUpstream warns about shaded modules that are deprecated upstream
+// or frozen at a retracted version, using the go.mod metadata the module
+// proxy serves. A failed lookup, offline say, is reported but does not
+// stop the run.
+func (g *Generator) checkUpstream() {
+	if len(g.modules) == 0 {
+		return
+	}
+	if proxy, _ := cmdOutput("", "go", "env", "GOPROXY"); proxy == "off" {
+		// go list then answers from the module cache without complaint
+		warnf("Not checking upstream status of shaded modules: GOPROXY=off")
+		return
+	}
+	modfile, cleanup, err := g.scratchModFlag()
+	if err != nil {
+		warnf("Could not check upstream status of shaded modules: %v", err)
+		return
+	}
+	defer cleanup()
+	// -mod=mod may write go.mod and go.sum: the scratch copy's, not the input's
+	args := []string{"list", "-mod=mod", modfile, "-m", "-u", "-retracted", "-json"}
+	for _, m := range g.modules {
+		args = append(args, m.Path)
+	}
+	var stderr bytes.Buffer
+	cmd := command("go", args...)
+	cmd.Dir = g.moduleDir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+		warnf("Could not check upstream status of shaded modules: %v (%s)", err, msg)
+		return
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var m struct {
+			Path       string
+			Version    string
+			Deprecated string
+			Retracted  []string
+			Update     *struct{ Version string }
+			Error      *struct{ Err string }
+		}
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			warnf("Could not check upstream status of shaded modules: %v", err)
+			return
+		}
+		if m.Error != nil {
+			warnf("Could not check upstream status of %s: %s", m.Path, m.Error.Err)
+			continue
+		}
+		latest := ""
+		if m.Update != nil {
+			latest = fmt.Sprintf(" (latest %s)", m.Update.Version)
+		}
+		var warnings []string
+		if m.Deprecated != "" {
+			warnings = append(warnings, fmt.Sprintf("%s is deprecated: %s%s", m.Path, m.Deprecated, latest))
+		}
+		if len(m.Retracted) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s %s is retracted: %s%s", m.Path, m.Version, strings.Join(m.Retracted, "; "), latest))
+		}
+		for _, w := range warnings {
+			warnf("%s", w)
+		}
+		g.report.UpstreamWarnings = append(g.report.UpstreamWarnings, warnings...)
+	}
+}
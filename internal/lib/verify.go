@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// 17. VERIFICATION
+// ---------------------------------------------------------
+
+// DefaultVerifyPlatforms is the matrix "-verify-platforms default" builds.
+var DefaultVerifyPlatforms = []string{"linux/amd64", "linux/arm64", "darwin/arm64", "windows/amd64"}
+
+// WasmVerifyPlatforms is what "-verify-platforms wasm" builds. Shaded
+// trees often pull in packages (os/exec, syscall, net) that break there.
+// TinyGo targets are spelled tinygo/<target>, e.g. tinygo/wasm.
+var WasmVerifyPlatforms = []string{"js/wasm", "wasip1/wasm"}
+
+// verifyPlatforms builds the generated module for each GOOS/GOARCH pair
+// in VerifyPlatforms, with cgo off, so files lost or broken for one
+// platform show up here rather than downstream.
+func (g *Generator) verifyPlatforms() error {
+	var failed []string
+	for _, platform := range g.VerifyPlatforms {
+		goos, goarch, ok := strings.Cut(platform, "/")
+		if !ok || goos == "" || goarch == "" {
+			return fmt.Errorf("bad platform %q, want GOOS/GOARCH", platform)
+		}
+		var out []byte
+		var err error
+		if goos == "tinygo" {
+			out, err = g.tinygoBuild(goarch)
+		} else {
+			cmd := command("go", "build", "./...")
+			cmd.Dir = g.OutputDir
+			cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+			out, err = cmd.CombinedOutput()
+		}
+		if err != nil {
+			fmt.Fprintf(progress(), "🧪 %s: ❌\n", platform)
+			failed = append(failed, fmt.Sprintf("%s:\n%s", platform, indent(strings.TrimSpace(string(out)))))
+			continue
+		}
+		fmt.Fprintf(progress(), "🧪 %s: ✅\n", platform)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("generated module does not build for:\n%s", strings.Join(failed, "\n"))
+	}
+	return nil
+}
+
+// tinygoBuild builds the generated module with TinyGo for target. TinyGo
+// builds programs, so library packages are compiled through a throwaway
+// main package importing them all; main packages are built as they are.
+func (g *Generator) tinygoBuild(target string) ([]byte, error) {
+	if _, err := exec.LookPath("tinygo"); err != nil {
+		return []byte("tinygo not found in PATH"), err
+	}
+	list, err := cmdOutput(g.OutputDir, "go", "list", "-f", "{{.Name}} {{.ImportPath}}", "./...")
+	if err != nil {
+		return []byte(list), err
+	}
+	tmp, err := os.MkdirTemp("", "bradley-tinygo-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	var probe strings.Builder
+	var mains []string
+	probe.WriteString("package main\n\nimport (\n")
+	for _, line := range strings.Split(list, "\n") {
+		name, pkg, _ := strings.Cut(line, " ")
+		if name == "main" {
+			mains = append(mains, pkg)
+		} else if pkg != "" {
+			fmt.Fprintf(&probe, "\t_ %q\n", pkg)
+		}
+	}
+	probe.WriteString(")\n\nfunc main() {}\n")
+	// The probe has to live inside the module to import its packages; a
+	// leading underscore keeps ./... patterns from ever picking it up.
+	probeDir := filepath.Join(g.OutputDir, "_bradley_tinygo")
+	if err := os.MkdirAll(probeDir, 0755); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(probeDir)
+	if err := os.WriteFile(filepath.Join(probeDir, "main.go"), []byte(probe.String()), 0644); err != nil {
+		return nil, err
+	}
+
+	var all []byte
+	for i, pkg := range append([]string{"./_bradley_tinygo"}, mains...) {
+		cmd := command("tinygo", "build", "-target="+target, "-o", filepath.Join(tmp, fmt.Sprintf("out%d", i)), pkg)
+		cmd.Dir = g.OutputDir
+		out, err := cmd.CombinedOutput()
+		all = append(all, out...)
+		if err != nil {
+			return all, err
+		}
+	}
+	return all, nil
+}
+
+func indent(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
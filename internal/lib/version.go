@@ -0,0 +1,49 @@
+package lib
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Build metadata, stamped at link time:
+//
+//	go build -ldflags "-X github.com/immanuel-254/bradley/internal/lib.Version=v1.2.0 -X github.com/immanuel-254/bradley/internal/lib.Commit=$(git rev-parse HEAD)"
+var (
+	Version = ""
+	Commit  = ""
+)
+
+// LockSchemaVersion is the schema version of the bradley.lock manifest.
+const LockSchemaVersion = 1
+
+type BuildInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	GoVersion  string `json:"go"`
+	LockSchema int    `json:"lock_schema"`
+}
+
+// ReadBuildInfo reports the producing build, falling back to the module
+// and VCS information the toolchain embeds when ldflags were not set.
+func ReadBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:    Version,
+		Commit:     Commit,
+		GoVersion:  runtime.Version(),
+		LockSchema: LockSchemaVersion,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			if s.Key == "vcs.revision" && info.Commit == "" {
+				info.Commit = s.Value
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	return info
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/immanuel-254/bradley/internal/lib"
+	"golang.org/x/mod/semver"
+)
+
+const releasesURL = "https://api.github.com/repos/immanuel-254/bradley/releases/latest"
+
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// selfUpdate replaces the running binary with the latest release when
+// that is newer. The download is checked against the release's
+// checksums.txt, which catches a corrupted or truncated download; the
+// release carries no signature, so nothing vouches for the release
+// itself beyond the HTTPS connection to GitHub.
+func selfUpdate(args []string) error {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := fs.Bool("check", false, "only report whether a newer release exists")
+	fs.Parse(args)
+
+	var rel release
+	body, err := httpGet(releasesURL)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, &rel); err != nil {
+		return fmt.Errorf("decoding release metadata: %w", err)
+	}
+
+	current := lib.ReadBuildInfo().Version
+	if !semver.IsValid(rel.TagName) {
+		return fmt.Errorf("latest release %q is not a semantic version", rel.TagName)
+	}
+	if !semver.IsValid(current) {
+		// (devel) and other builds from source are no release to compare
+		fmt.Printf("bradley %s is a build from source; the latest release is %s\n", current, rel.TagName)
+		return nil
+	}
+	if semver.Compare(rel.TagName, current) <= 0 {
+		fmt.Printf("bradley %s is up to date\n", current)
+		return nil
+	}
+	fmt.Printf("bradley %s is available (running %s)\n", rel.TagName, current)
+	if *check {
+		return nil
+	}
+
+	binName := fmt.Sprintf("bradley_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		binName += ".exe"
+	}
+	var binURL, sumsURL string
+	for _, a := range rel.Assets {
+		switch a.Name {
+		case binName:
+			binURL = a.URL
+		case "checksums.txt":
+			sumsURL = a.URL
+		}
+	}
+	if binURL == "" || sumsURL == "" {
+		return fmt.Errorf("release %s has no %s or checksums.txt asset", rel.TagName, binName)
+	}
+
+	sums, err := httpGet(sumsURL)
+	if err != nil {
+		return err
+	}
+	want, err := lookupChecksum(sums, binName)
+	if err != nil {
+		return err
+	}
+	bin, err := httpGet(binURL)
+	if err != nil {
+		return err
+	}
+	got := sha256.Sum256(bin)
+	if hex.EncodeToString(got[:]) != want {
+		return fmt.Errorf("checksum mismatch for %s: got %x, want %s", binName, got, want)
+	}
+
+	if err := replaceExecutable(bin); err != nil {
+		return err
+	}
+	fmt.Printf("Updated to %s\n", rel.TagName)
+	return nil
+}
+
+// lookupChecksum finds name in a sha256sum-style listing.
+func lookupChecksum(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("checksums.txt has no entry for %s", name)
+}
+
+// replaceExecutable swaps the running binary for bin. The old binary is
+// moved aside first, which also works on Windows where a running
+// executable cannot be overwritten but can be renamed.
+func replaceExecutable(bin []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	newPath, oldPath := exe+".new", exe+".old"
+	if err := os.WriteFile(newPath, bin, 0755); err != nil {
+		return err
+	}
+	os.Remove(oldPath)
+	if err := os.Rename(exe, oldPath); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+	if err := os.Rename(newPath, exe); err != nil {
+		os.Rename(oldPath, exe) // Put the original back
+		return err
+	}
+	os.Remove(oldPath) // Fails harmlessly on Windows while still running
+	return nil
+}
+
+// httpClient bounds each request, reading the response included, so a
+// stalled download fails instead of hanging the update.
+var httpClient = &http.Client{Timeout: 2 * time.Minute}
+
+func httpGet(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}